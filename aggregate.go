@@ -0,0 +1,100 @@
+package modm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PipelineBuilder is implemented by aggregation pipeline builders. The aggregate functions accept
+// a PipelineBuilder wherever a pipeline is expected and build it before running the command.
+type PipelineBuilder interface {
+	Build() (mongo.Pipeline, error)
+}
+
+// buildPipeline builds pipeline if it is a PipelineBuilder.
+func buildPipeline(pipeline interface{}) (interface{}, error) {
+	if b, ok := pipeline.(PipelineBuilder); ok {
+		return b.Build()
+	}
+	return pipeline, nil
+}
+
+// WithAfterFind returns a context that makes the typed aggregate functions run AfterFind and
+// AfterFindE on the results, when the result type is a Document.
+// Aggregation results are often not whole documents, so the hooks do not run by default.
+func WithAfterFind(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyAfterFind, true)
+}
+
+// AggregateAs executes an aggregate command against the collection of repo and decodes the
+// results into a slice of R:
+//
+//	type AgeCount struct {
+//		Age   uint  `bson:"_id"`
+//		Count int64 `bson:"count"`
+//	}
+//	counts, err := modm.AggregateAs[AgeCount](ctx, db.Users, mongo.Pipeline{
+//		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$age"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+//	})
+//
+// Hooks: AfterFind, AfterFindE (with WithAfterFind)
+func AggregateAs[R any, T Document](ctx context.Context, repo *Repo[T], pipeline interface{}, opts ...*options.AggregateOptions) ([]R, error) {
+	res := make([]R, 0)
+	if err := repo.Aggregate(ctx, pipeline, &res, opts...); err != nil {
+		return nil, err
+	}
+	if ctxFlag(ctx, ctxKeyAfterFind) {
+		for i, doc := range res {
+			if d, ok := interface{}(doc).(Document); ok {
+				d.AfterFind(ctx)
+				if err := runAfterFind(ctx, doc, i); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// AggregateIter executes an aggregate command against the collection of repo and returns an
+// Iterator that decodes the results into R one at a time. The caller must Close it.
+// Hooks: AfterFind, AfterFindE (with WithAfterFind)
+func AggregateIter[R any, T Document](ctx context.Context, repo *Repo[T], pipeline interface{}, opts ...*options.AggregateOptions) (*Iterator[R], error) {
+	pipeline, err := buildPipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	op := &Op{Kind: OpAggregateIter, Filter: pipeline, Options: opts}
+	err = repo.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.AggregateOptions)
+		cursor, err := repo.collection.Aggregate(ctx, op.Filter, opts...)
+		op.Result = cursor
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	cursor, _ := op.Result.(*mongo.Cursor)
+	return newIterator[R](ctx, cursor, ctxFlag(ctx, ctxKeyAfterFind)), nil
+}
+
+// AggregateOne executes an aggregate command against the collection of repo and decodes the
+// first result into R. It returns ErrNotFound if the pipeline has no results.
+// Hooks: AfterFind, AfterFindE (with WithAfterFind)
+func AggregateOne[R any, T Document](ctx context.Context, repo *Repo[T], pipeline interface{}, opts ...*options.AggregateOptions) (R, error) {
+	var zero R
+	it, err := AggregateIter[R](ctx, repo, pipeline, opts...)
+	if err != nil {
+		return zero, err
+	}
+	defer it.Close()
+	if !it.Next() {
+		if err := it.Err(); err != nil {
+			return zero, err
+		}
+		return zero, ErrNotFound
+	}
+	return it.Doc(), nil
+}
@@ -0,0 +1,89 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type testPipelineBuilder struct {
+	pipeline mongo.Pipeline
+	err      error
+}
+
+func (b testPipelineBuilder) Build() (mongo.Pipeline, error) {
+	return b.pipeline, b.err
+}
+
+func TestBuildPipeline(t *testing.T) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{}}}}
+	got, err := buildPipeline(testPipelineBuilder{pipeline: pipeline})
+	require.NoError(t, err)
+	assert.Equal(t, pipeline, got)
+
+	raw := []bson.M{{"$match": bson.M{}}}
+	got, err = buildPipeline(raw)
+	require.NoError(t, err)
+	assert.Equal(t, raw, got)
+
+	errBuild := errors.New("build")
+	_, err = buildPipeline(testPipelineBuilder{err: errBuild})
+	assert.ErrorIs(t, err, errBuild)
+}
+
+func TestAggregateAs(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.InsertMany(ctx, []*TestUser{{Name: "go", Age: 2}, {Name: "goo", Age: 3}, {Name: "ggo", Age: 3}})
+	require.NoError(t, err)
+
+	type ageCount struct {
+		Age   uint  `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	counts, err := AggregateAs[ageCount](ctx, repo, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$age"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []ageCount{{Age: 2, Count: 1}, {Age: 3, Count: 2}}, counts)
+
+	sorted := mongo.Pipeline{{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}}}}}
+	users, err := AggregateAs[*TestUser](ctx, repo, sorted)
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Empty(t, users[0].Bio)
+
+	users, err = AggregateAs[*TestUser](WithAfterFind(ctx), repo, sorted)
+	require.NoError(t, err)
+	assert.Equal(t, "ggo is 3 years old.", users[0].Bio)
+
+	it, err := AggregateIter[*TestUser](WithAfterFind(ctx), repo, testPipelineBuilder{pipeline: sorted})
+	require.NoError(t, err)
+	var names []string
+	for it.Next() {
+		names = append(names, it.Doc().Name)
+		assert.NotEmpty(t, it.Doc().Bio)
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+	assert.Equal(t, []string{"ggo", "go", "goo"}, names)
+
+	type countResult struct {
+		N int64 `bson:"n"`
+	}
+	total, err := AggregateOne[countResult](ctx, repo, mongo.Pipeline{{{Key: "$count", Value: "n"}}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total.N)
+
+	_, err = AggregateOne[bson.M](ctx, repo, mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "age", Value: 9}}}}})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
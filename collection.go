@@ -26,14 +26,31 @@ func (r *Repo[T]) Name() string {
 // The filter parameter must be a document and can be used to select which documents contribute to the count. It cannot be nil. An empty document (e.g. bson.D{}) should be used to count all documents in the collection. This will result in a full collection scan.
 // The opts parameter can be used to specify options for the operation (see the options.CountOptions documentation).
 func (r *Repo[T]) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	return r.collection.CountDocuments(ctx, filter, opts...)
+	op := &Op{Kind: OpCountDocuments, Filter: r.scope(ctx, filter), Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.CountOptions)
+		count, err := r.collection.CountDocuments(ctx, op.Filter, opts...)
+		op.Result = count
+		return err
+	})
+	count, _ := op.Result.(int64)
+	return count, err
 }
 
 // EstimatedDocumentCount executes a count command and returns an estimate of the number of documents in the collection using collection metadata.
 // The opts parameter can be used to specify options for the operation (see the options.EstimatedDocumentCountOptions documentation).
+// The estimate includes soft-deleted documents.
 // For more information about the command, see https://www.mongodb.com/docs/manual/reference/command/count/.
 func (r *Repo[T]) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
-	return r.collection.EstimatedDocumentCount(ctx, opts...)
+	op := &Op{Kind: OpEstimatedDocumentCount, Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.EstimatedDocumentCountOptions)
+		count, err := r.collection.EstimatedDocumentCount(ctx, opts...)
+		op.Result = count
+		return err
+	})
+	count, _ := op.Result.(int64)
+	return count, err
 }
 
 // Distinct executes a distinct command to find the unique values for a specified field in the collection.
@@ -42,19 +59,42 @@ func (r *Repo[T]) EstimatedDocumentCount(ctx context.Context, opts ...*options.E
 // The opts parameter can be used to specify options for the operation (see the options.DistinctOptions documentation).
 // For more information about the command, see https://www.mongodb.com/docs/manual/reference/command/distinct/.
 func (r *Repo[T]) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
-	return r.collection.Distinct(ctx, fieldName, filter, opts...)
+	op := &Op{Kind: OpDistinct, Field: fieldName, Filter: r.scope(ctx, filter), Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.DistinctOptions)
+		values, err := r.collection.Distinct(ctx, op.Field, op.Filter, opts...)
+		op.Result = values
+		return err
+	})
+	values, _ := op.Result.([]interface{})
+	return values, err
 }
 
 // Aggregate executes an aggregate command against the collection and returns a cursor over the resulting documents.
 // The pipeline parameter must be an array of documents, each representing an aggregation stage. The pipeline cannot be nil but can be empty. The stage documents must all be non-nil. For a pipeline of bson.D documents, the mongo.Pipeline type can be used. See https://www.mongodb.com/docs/manual/reference/operator/aggregation-pipeline/#db-collection-aggregate-stages for a list of valid stages in aggregations.
+// The pipeline may also be a PipelineBuilder.
 // The opts parameter can be used to specify options for the operation (see the options.AggregateOptions documentation.)
 // For more information about the command, see https://www.mongodb.com/docs/manual/reference/command/aggregate/.
+// See AggregateAs for a typed variant.
 func (r *Repo[T]) Aggregate(ctx context.Context, pipeline interface{}, res interface{}, opts ...*options.AggregateOptions) error {
-	cursor, err := r.collection.Aggregate(ctx, pipeline, opts...)
-	if err == nil {
-		err = cursor.All(ctx, res)
+	pipeline, err := buildPipeline(pipeline)
+	if err != nil {
+		return err
 	}
-	return err
+	op := &Op{Kind: OpAggregate, Filter: pipeline, Options: opts}
+	return r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.AggregateOptions)
+		cursor, err := r.collection.Aggregate(ctx, op.Filter, opts...)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		if err := cursor.All(ctx, res); err != nil {
+			return err
+		}
+		op.Result = res
+		return nil
+	})
 }
 
 // [MODM] Count counts the number of documents in the collection that match the filter.
@@ -0,0 +1,28 @@
+package modm
+
+import "context"
+
+type ctxKey int
+
+const (
+	ctxKeyDeletedDocs ctxKey = iota
+	ctxKeyTrashed
+	ctxKeyForceDelete
+	ctxKeyVersion
+	ctxKeyAfterFind
+	ctxKeyPopulate
+	ctxKeyDuplicates
+)
+
+// WithDeletedDocs returns a context that makes delete operations load the documents
+// being removed and pass them to BeforeDelete/AfterDelete hooks via DeleteEvent.Docs.
+// The documents are read with an OpFind through the interceptors and held in memory; for
+// DeleteMany, all the matching documents are loaded, so avoid it for large deletes.
+func WithDeletedDocs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyDeletedDocs, true)
+}
+
+func ctxFlag(ctx context.Context, key ctxKey) bool {
+	v, _ := ctx.Value(key).(bool)
+	return v
+}
@@ -2,139 +2,493 @@ package modm
 
 import (
 	"context"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // InsertOne inserts a single document into the collection.
-// Hooks: BeforeInsert, AfterInsert
+// Fields tagged with `modm:"seq=key"` are assigned after BeforeInsert (see SetSequence).
+// The document is validated after the hooks (see Validate).
+// Hooks: BeforeInsert, BeforeInsertE, AfterInsert, AfterInsertE
 func (r *Repo[T]) InsertOne(ctx context.Context, doc T, opts ...*options.InsertOneOptions) (T, error) {
 	doc.BeforeInsert(ctx)
+	if err := r.assignSequences(ctx, []T{doc}); err != nil {
+		return *new(T), err
+	}
+	if err := runBeforeInsert(ctx, doc, 0); err != nil {
+		return *new(T), err
+	}
+	if err := Validate(doc); err != nil {
+		return *new(T), err
+	}
 	defer doc.AfterInsert(ctx)
-	res, err := r.collection.InsertOne(ctx, doc, opts...)
+	op := &Op{Kind: OpInsertOne, Docs: doc, Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.InsertOneOptions)
+		res, err := r.collection.InsertOne(ctx, op.Docs, opts...)
+		op.Result = res
+		return err
+	})
 	if err != nil {
 		return *new(T), err
 	}
-	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
-		doc.SetID(id)
+	if res, ok := op.Result.(*mongo.InsertOneResult); ok && res != nil {
+		setDocumentID(doc, res.InsertedID)
+	}
+	if err := runAfterInsert(ctx, doc, 0); err != nil {
+		return doc, err
 	}
 	return doc, nil
 }
 
 // InsertMany inserts multiple documents into the collection.
-// Hooks: BeforeInsert, AfterInsert
+// Fields tagged with `modm:"seq=key"` are assigned after BeforeInsert (see SetSequence).
+// The documents are validated after the hooks (see Validate).
+// Hooks: BeforeInsert, BeforeInsertE, AfterInsert, AfterInsertE
+// If any BeforeInsertE hook fails or any document is invalid, no document is inserted.
 func (r *Repo[T]) InsertMany(ctx context.Context, docs []T, opts ...*options.InsertManyOptions) error {
-	var list []interface{}
 	for _, doc := range docs {
 		doc.BeforeInsert(ctx)
-		defer doc.AfterInsert(ctx)
+	}
+	if err := r.assignSequences(ctx, docs); err != nil {
+		return err
+	}
+	var list []interface{}
+	for i, doc := range docs {
+		if err := runBeforeInsert(ctx, doc, i); err != nil {
+			return err
+		}
 		list = append(list, doc)
 	}
-	_, err := r.collection.InsertMany(ctx, list, opts...)
-	return err
+	for i, doc := range docs {
+		if err := Validate(doc); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Index = i
+			}
+			return err
+		}
+	}
+	for _, doc := range docs {
+		defer doc.AfterInsert(ctx)
+	}
+	op := &Op{Kind: OpInsertMany, Docs: list, Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		list, _ := op.Docs.([]interface{})
+		opts, _ := op.Options.([]*options.InsertManyOptions)
+		res, err := r.collection.InsertMany(ctx, list, opts...)
+		op.Result = res
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if res, ok := op.Result.(*mongo.InsertManyResult); ok && res != nil && len(res.InsertedIDs) == len(docs) {
+		for i, doc := range docs {
+			setDocumentID(doc, res.InsertedIDs[i])
+		}
+	}
+	for i, doc := range docs {
+		if err := runAfterInsert(ctx, doc, i); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // DeleteOne deletes a single document based on the provided filter.
+// If T embeds SoftDeleteField, the document is soft-deleted.
+// Hooks: BeforeDelete, AfterDelete
 func (r *Repo[T]) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error) {
-	res, err := r.collection.DeleteOne(ctx, filter, opts...)
-	return res.DeletedCount, err
+	return r.delete(ctx, OpDeleteOne, filter, opts)
 }
 
 // DeleteMany deletes multiple documents based on the provided filter.
+// If T embeds SoftDeleteField, the documents are soft-deleted.
+// Hooks: BeforeDelete, AfterDelete
 func (r *Repo[T]) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error) {
-	res, err := r.collection.DeleteMany(ctx, filter, opts...)
-	return res.DeletedCount, err
+	return r.delete(ctx, OpDeleteMany, filter, opts)
+}
+
+func (r *Repo[T]) delete(ctx context.Context, kind OpKind, filter interface{}, opts []*options.DeleteOptions) (int64, error) {
+	var limit int64
+	if kind == OpDeleteOne {
+		limit = 1
+	}
+	event, filter, err := r.beforeDelete(ctx, filter, deleteFindOptions(opts, limit))
+	if err != nil {
+		return 0, err
+	}
+	op := &Op{Kind: kind, Filter: r.scope(ctx, filter), Options: opts}
+	if r.softDeleting(ctx) {
+		op.Filter = r.scope(context.Background(), filter)
+		op.Update = softDeleteUpdate()
+	}
+	err = r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.DeleteOptions)
+		var res interface{}
+		var err error
+		switch {
+		case op.Update != nil && op.Kind == OpDeleteOne:
+			res, err = r.collection.UpdateOne(ctx, op.Filter, op.Update, deleteToUpdateOptions(opts))
+		case op.Update != nil:
+			res, err = r.collection.UpdateMany(ctx, op.Filter, op.Update, deleteToUpdateOptions(opts))
+		case op.Kind == OpDeleteOne:
+			res, err = r.collection.DeleteOne(ctx, op.Filter, opts...)
+		default:
+			res, err = r.collection.DeleteMany(ctx, op.Filter, opts...)
+		}
+		op.Result = res
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var deletedCount int64
+	switch res := op.Result.(type) {
+	case *mongo.DeleteResult:
+		if res != nil {
+			deletedCount = res.DeletedCount
+		}
+	case *mongo.UpdateResult:
+		if res != nil {
+			deletedCount = res.ModifiedCount
+		}
+	}
+	return deletedCount, r.afterDelete(ctx, event, deletedCount)
+}
+
+// DeleteByID deletes a document by ID.
+// If T embeds SoftDeleteField, the document is soft-deleted.
+// Hooks: BeforeDelete, AfterDelete
+func (r *Repo[T]) DeleteByID(ctx context.Context, id interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error) {
+	return r.DeleteOne(ctx, bson.M{"_id": id}, opts...)
 }
 
 // UpdateByID updates a document by ID with the provided update/document.
+// If T embeds VersionField, the update is versioned (see UpdateOne).
 // Hooks(document): BeforeUpdate, AfterUpdate
 func (r *Repo[T]) UpdateByID(ctx context.Context, id interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error) {
 	return r.UpdateOne(ctx, bson.M{"_id": id}, updateOrDoc, opts...)
 }
 
 // UpdateOne updates a single document based on the provided filter and update/document.
-// Hooks(document): BeforeUpdate, AfterUpdate
+// The update may be a document of T, an *Update[T] or a raw update document. Documents are
+// validated after the hooks (see Validate), and so are the $set values of an *Update[T].
+// If T embeds VersionField and a document is passed, or the context is created with WithVersion,
+// the update only matches the expected version and increments it; ErrVersionConflict is returned
+// if no document matches.
+// Hooks(document): BeforeUpdate, BeforeUpdateE, AfterUpdate, AfterUpdateE
 func (r *Repo[T]) UpdateOne(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error) {
-	if doc, ok := updateOrDoc.(T); ok {
-		doc.BeforeUpdate(ctx)
-		defer doc.AfterUpdate(ctx)
-		res, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": doc}, opts...)
-		return res.ModifiedCount, err
-	}
-	res, err := r.collection.UpdateOne(ctx, filter, updateOrDoc, opts...)
-	return res.ModifiedCount, err
+	return r.update(ctx, OpUpdateOne, filter, updateOrDoc, opts)
 }
 
 // UpdateMany updates multiple documents based on the provided filter and update/document.
-// Hooks(document): BeforeUpdate, AfterUpdate
+// Hooks(document): BeforeUpdate, BeforeUpdateE, AfterUpdate, AfterUpdateE
 func (r *Repo[T]) UpdateMany(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error) {
-	if doc, ok := updateOrDoc.(T); ok {
+	return r.update(ctx, OpUpdateMany, filter, updateOrDoc, opts)
+}
+
+func (r *Repo[T]) update(ctx context.Context, kind OpKind, filter interface{}, updateOrDoc interface{}, opts []*options.UpdateOptions) (int64, error) {
+	update := updateOrDoc
+	doc, isDoc := updateOrDoc.(T)
+	if isDoc {
 		doc.BeforeUpdate(ctx)
+		if err := runBeforeUpdate(ctx, doc, 0); err != nil {
+			return 0, err
+		}
+		if err := validateDocument(doc, true); err != nil {
+			return 0, err
+		}
 		defer doc.AfterUpdate(ctx)
-		res, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": doc}, opts...)
-		return res.ModifiedCount, err
+		var err error
+		if update, err = r.documentSet(doc); err != nil {
+			return 0, err
+		}
 	}
-	res, err := r.collection.UpdateMany(ctx, filter, updateOrDoc, opts...)
-	return res.ModifiedCount, err
+	if u, ok := updateOrDoc.(*Update[T]); ok {
+		rendered, err := u.render(ctx)
+		if err != nil {
+			return 0, err
+		}
+		update = rendered
+		if filters := u.ArrayFilters(); len(filters) > 0 {
+			opts = append(opts, options.Update().SetArrayFilters(options.ArrayFilters{Filters: filters}))
+		}
+	}
+	filter = r.scope(ctx, filter)
+	version, isVersioned := r.versioning(ctx, updateOrDoc)
+	isVersioned = isVersioned && kind == OpUpdateOne
+	if isVersioned {
+		var err error
+		if filter, update, err = r.applyVersion(filter, updateOrDoc, update, version); err != nil {
+			return 0, err
+		}
+	}
+	op := &Op{Kind: kind, Filter: filter, Update: update, Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.UpdateOptions)
+		var res *mongo.UpdateResult
+		var err error
+		if op.Kind == OpUpdateOne {
+			res, err = r.collection.UpdateOne(ctx, op.Filter, op.Update, opts...)
+		} else {
+			res, err = r.collection.UpdateMany(ctx, op.Filter, op.Update, opts...)
+		}
+		op.Result = res
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var modifiedCount int64
+	res, _ := op.Result.(*mongo.UpdateResult)
+	if res != nil {
+		modifiedCount = res.ModifiedCount
+	}
+	if isVersioned {
+		if res == nil || res.MatchedCount == 0 {
+			return 0, ErrVersionConflict
+		}
+		if v, ok := interface{}(doc).(versioned); isDoc && ok {
+			v.versionField().Version = version + 1
+		}
+	}
+	if isDoc {
+		return modifiedCount, runAfterUpdate(ctx, doc, 0)
+	}
+	return modifiedCount, nil
 }
 
-// Find retrieves multiple documents based on the provided filter.
-// Hooks: AfterFind
-func (r *Repo[T]) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (docs []T, err error) {
-	docs = make([]T, 0)
-	cursor, err := r.collection.Find(ctx, filter, opts...)
+// documentSet returns the update of an update with a document. The deleted_at field of a
+// soft-deletable document is left out, so that only Restore restores a document, and the version
+// field of a versioned document is incremented instead of set.
+func (r *Repo[T]) documentSet(doc T) (interface{}, error) {
+	var skip []string
+	if r.softDelete {
+		skip = append(skip, "deleted_at")
+	}
+	_, isVersioned := interface{}(doc).(versioned)
+	if isVersioned {
+		skip = append(skip, "version")
+	}
+	if len(skip) == 0 {
+		return bson.M{"$set": doc}, nil
+	}
+	raw, err := bson.Marshal(doc)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer cursor.Close(ctx)
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return nil, err
+	}
+	set := make(bson.D, 0, len(elems))
+	for _, elem := range elems {
+		skipped := false
+		for _, key := range skip {
+			skipped = skipped || elem.Key() == key
+		}
+		if !skipped {
+			set = append(set, bson.E{Key: elem.Key(), Value: elem.Value()})
+		}
+	}
+	update := bson.D{{Key: "$set", Value: set}}
+	if isVersioned {
+		update = append(update, bson.E{Key: "$inc", Value: bson.D{{Key: "version", Value: int64(1)}}})
+	}
+	return update, nil
+}
 
-	if err = cursor.All(ctx, &docs); err != nil {
+// Find retrieves multiple documents based on the provided filter.
+// References requested with Populate are loaded after the hooks.
+// Hooks: AfterFind, AfterFindE
+func (r *Repo[T]) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (docs []T, err error) {
+	op := &Op{Kind: OpFind, Filter: r.scope(ctx, filter), Options: opts}
+	err = r.invoke(ctx, op, r.find)
+	docs, _ = op.Result.([]T)
+	if docs == nil {
+		docs = make([]T, 0)
+	}
+	if err != nil {
 		return
 	}
 
-	for _, doc := range docs {
+	for i, doc := range docs {
 		doc.AfterFind(ctx)
+		if err = runAfterFind(ctx, doc, i); err != nil {
+			return
+		}
 	}
+	err = r.populate(ctx, docs)
 	return
 }
 
 // FindOne retrieves a single document based on the provided filter.
-// Hooks: AfterFind
+// References requested with Populate are loaded after the hooks.
+// Hooks: AfterFind, AfterFindE
 func (r *Repo[T]) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (doc T, err error) {
-	err = r.collection.FindOne(ctx, filter, opts...).Decode(&doc)
-	if err == nil {
-		doc.AfterFind(ctx)
+	op := &Op{Kind: OpFindOne, Filter: r.scope(ctx, filter), Options: opts}
+	err = r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.FindOneOptions)
+		var doc T
+		if err := r.collection.FindOne(ctx, op.Filter, opts...).Decode(&doc); err != nil {
+			return err
+		}
+		op.Result = doc
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	doc, _ = op.Result.(T)
+	doc.AfterFind(ctx)
+	if err = runAfterFind(ctx, doc, 0); err != nil {
+		return
 	}
+	docs := []T{doc}
+	err = r.populate(ctx, docs)
+	doc = docs[0]
 	return
 }
 
+// find is the handler of OpFind: it decodes the documents that match op.Filter into op.Result.
+func (r *Repo[T]) find(ctx context.Context, op *Op) error {
+	opts, _ := op.Options.([]*options.FindOptions)
+	cursor, err := r.collection.Find(ctx, op.Filter, opts...)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	docs := make([]T, 0)
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+	op.Result = docs
+	return nil
+}
+
 // FindOneAndDelete retrieves and deletes a single document based on the provided filter.
-// Hooks: AfterFind
+// If T embeds SoftDeleteField, the document is soft-deleted.
+// Hooks: BeforeDelete, AfterFind, AfterFindE, AfterDelete
 func (r *Repo[T]) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) (doc T, err error) {
-	err = r.collection.FindOneAndDelete(ctx, filter, opts...).Decode(&doc)
+	event, filter, err := r.beforeDelete(ctx, filter, findOneAndDeleteFindOptions(opts))
+	if err != nil {
+		return
+	}
+	op := &Op{Kind: OpFindOneAndDelete, Filter: r.scope(ctx, filter), Options: opts}
+	if r.softDeleting(ctx) {
+		op.Filter = r.scope(context.Background(), filter)
+		op.Update = softDeleteUpdate()
+	}
+	err = r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.FindOneAndDeleteOptions)
+		var res *mongo.SingleResult
+		if op.Update != nil {
+			res = r.collection.FindOneAndUpdate(ctx, op.Filter, op.Update, findOneAndDeleteToUpdateOptions(opts))
+		} else {
+			res = r.collection.FindOneAndDelete(ctx, op.Filter, opts...)
+		}
+		var doc T
+		if err := res.Decode(&doc); err != nil {
+			return err
+		}
+		op.Result = doc
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	doc, _ = op.Result.(T)
 	doc.AfterFind(ctx)
+	if err = runAfterFind(ctx, doc, 0); err != nil {
+		return
+	}
+	event.Docs = []T{doc}
+	err = r.afterDelete(ctx, event, 1)
 	return
 }
 
 // FindOneAndUpdate retrieves, updates, and returns a single document based on the provided filter and update/document.
-// Hooks: BeforeUpdate(document), AfterUpdate(document), AfterFind
+// Versioning applies as in UpdateOne.
+// Hooks: BeforeUpdate(document), BeforeUpdateE(document), AfterUpdate(document), AfterUpdateE(document), AfterFind, AfterFindE
 func (r *Repo[T]) FindOneAndUpdate(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.FindOneAndUpdateOptions) (T, error) {
 	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
-	if doc, ok := updateOrDoc.(T); ok {
+	update := updateOrDoc
+	doc, isDoc := updateOrDoc.(T)
+	if isDoc {
 		doc.BeforeUpdate(ctx)
+		if err := runBeforeUpdate(ctx, doc, 0); err != nil {
+			return doc, err
+		}
+		if err := validateDocument(doc, true); err != nil {
+			return doc, err
+		}
 		defer doc.AfterUpdate(ctx)
-		err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": doc}, opts...).Decode(&doc)
-		return doc, err
+		var err error
+		if update, err = r.documentSet(doc); err != nil {
+			return doc, err
+		}
 	}
-	var doc T
-	err := r.collection.FindOneAndUpdate(ctx, filter, updateOrDoc, opts...).Decode(&doc)
-	doc.AfterFind(ctx)
-	return doc, err
+	if u, ok := updateOrDoc.(*Update[T]); ok {
+		rendered, err := u.render(ctx)
+		if err != nil {
+			return doc, err
+		}
+		update = rendered
+		if filters := u.ArrayFilters(); len(filters) > 0 {
+			opts = append(opts, options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{Filters: filters}))
+		}
+	}
+	filter = r.scope(ctx, filter)
+	version, isVersioned := r.versioning(ctx, updateOrDoc)
+	if isVersioned {
+		var err error
+		if filter, update, err = r.applyVersion(filter, updateOrDoc, update, version); err != nil {
+			return doc, err
+		}
+	}
+	op := &Op{Kind: OpFindOneAndUpdate, Filter: filter, Update: update, Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.FindOneAndUpdateOptions)
+		res := r.collection.FindOneAndUpdate(ctx, op.Filter, op.Update, opts...)
+		if isDoc {
+			// Decode into the caller's document so fields excluded from the update are kept.
+			if err := res.Decode(&doc); err != nil {
+				return err
+			}
+			op.Result = doc
+			return nil
+		}
+		var found T
+		if err := res.Decode(&found); err != nil {
+			return err
+		}
+		op.Result = found
+		return nil
+	})
+	if isVersioned && errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrVersionConflict
+	}
+	if isDoc {
+		if err != nil {
+			return doc, err
+		}
+		return doc, runAfterUpdate(ctx, doc, 0)
+	}
+	if err != nil {
+		return *new(T), err
+	}
+	found, _ := op.Result.(T)
+	found.AfterFind(ctx)
+	return found, runAfterFind(ctx, found, 0)
 }
 
-// [MODM] Get retrieves a single document by ID(ObjectID) from the collection.
+// [MODM] Get retrieves a single document by ID from the collection.
 func (r *Repo[T]) Get(ctx context.Context, id interface{}, opts ...*options.FindOneOptions) (T, error) {
 	return r.FindOne(ctx, bson.M{"_id": id}, opts...)
 }
@@ -270,6 +270,7 @@ func TestRepo_FindOne(t *testing.T) {
 
 	result, err := repo.FindOne(ctx, bson.M{"name": "BUG"})
 	require.True(t, err == mongo.ErrNoDocuments)
+	require.ErrorIs(t, err, ErrNotFound)
 	require.Nil(t, result)
 }
 
@@ -2,6 +2,7 @@ package modm
 
 import (
 	"context"
+	"reflect"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -9,6 +10,8 @@ import (
 )
 
 // Document represents an interface for common document operations.
+// An ObjectID assigned on insert is set with SetID. Other IDs are set with a SetIDOf method
+// accepting them, if the document has one, or else written to its _id field.
 type Document interface {
 	SetID(id primitive.ObjectID)
 	BeforeInsert(ctx context.Context)
@@ -20,7 +23,11 @@ type Document interface {
 
 // Repo is a generic repository for working with MongoDB collections.
 type Repo[T Document] struct {
-	collection *mongo.Collection
+	collection   *mongo.Collection
+	interceptors []Interceptor
+	softDelete   bool
+	refs         map[string]*reference
+	sequence     *Sequence
 }
 
 // NewRepo creates a new repository for the given MongoDB collection.
@@ -28,6 +35,7 @@ func NewRepo[T Document](collection *mongo.Collection) *Repo[T] {
 	repo := Repo[T]{
 		collection: collection,
 	}
+	_, repo.softDelete = interface{}(newDocument[T]()).(softDeletable)
 	return &repo
 }
 
@@ -38,9 +46,12 @@ type IRepo[T Document] interface {
 	Collection() *mongo.Collection
 	Count(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
 	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	DeleteByID(ctx context.Context, id interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error)
 	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error)
 	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error)
 	Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error)
+	Each(ctx context.Context, filter interface{}, fn func(doc T) error, opts ...*options.FindOptions) error
+	EnsureCollection(ctx context.Context, spec CollectionSpec) (*CollectionReport, error)
 	EnsureIndexes(ctx context.Context, uniques []string, indexes []string, indexModels ...mongo.IndexModel) error
 	EnsureIndexesByModel(ctx context.Context, model Indexes) error
 	EstimatedCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error)
@@ -49,13 +60,70 @@ type IRepo[T Document] interface {
 	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (doc T, err error)
 	FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) (doc T, err error)
 	FindOneAndUpdate(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.FindOneAndUpdateOptions) (T, error)
+	ForceDelete(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error)
 	Get(ctx context.Context, id interface{}, opts ...*options.FindOneOptions) (T, error)
+	InstallSchema(ctx context.Context, level, action string) error
 	InsertMany(ctx context.Context, docs []T, opts ...*options.InsertManyOptions) error
 	InsertOne(ctx context.Context, doc T, opts ...*options.InsertOneOptions) (T, error)
+	Iter(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*Iterator[T], error)
 	Name() string
+	Paginate(ctx context.Context, filter interface{}, req PageRequest) (Page[T], error)
+	Pipeline() *Pipeline[T]
+	Restore(ctx context.Context, filter interface{}, opts ...*options.UpdateOptions) (restoredCount int64, err error)
+	SetSequence(seq *Sequence)
+	SyncIndexes(ctx context.Context, opts SyncIndexesOptions) (*IndexPlan, error)
 	UpdateByID(ctx context.Context, id interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error)
 	UpdateMany(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error)
 	UpdateOne(ctx context.Context, filter interface{}, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error)
+	Use(interceptors ...Interceptor)
 }
 
 var _ IRepo[*DefaultField] = NewRepo[*DefaultField](nil)
+
+// RepoOf is a Repo whose documents have an _id of type ID, with typed ID methods next to the
+// methods of Repo, so that it still satisfies IRepo[T]:
+//
+//	type Order struct {
+//		modm.DefaultFieldOf[string] `bson:",inline"`
+//		...
+//	}
+//	orders := modm.NewRepoOf[*Order, string](db.Collection("orders"))
+//	order, err := orders.GetOf(ctx, "01HV6ZJ3Q9...")
+type RepoOf[T Document, ID comparable] struct {
+	*Repo[T]
+}
+
+var _ IRepo[*DefaultFieldOf[string]] = NewRepoOf[*DefaultFieldOf[string], string](nil)
+
+// NewRepoOf creates a new repository with IDs of type ID for the given MongoDB collection.
+func NewRepoOf[T Document, ID comparable](collection *mongo.Collection) *RepoOf[T, ID] {
+	return &RepoOf[T, ID]{Repo: NewRepo[T](collection)}
+}
+
+// GetOf retrieves a single document by ID from the collection.
+// Hooks: AfterFind, AfterFindE
+func (r *RepoOf[T, ID]) GetOf(ctx context.Context, id ID, opts ...*options.FindOneOptions) (T, error) {
+	return r.Repo.Get(ctx, id, opts...)
+}
+
+// UpdateByIDOf updates a document by ID with the provided update/document.
+// Hooks(document): BeforeUpdate, AfterUpdate
+func (r *RepoOf[T, ID]) UpdateByIDOf(ctx context.Context, id ID, updateOrDoc interface{}, opts ...*options.UpdateOptions) (modifiedCount int64, err error) {
+	return r.Repo.UpdateByID(ctx, id, updateOrDoc, opts...)
+}
+
+// DeleteByIDOf deletes a document by ID.
+// Hooks: BeforeDelete, AfterDelete
+func (r *RepoOf[T, ID]) DeleteByIDOf(ctx context.Context, id ID, opts ...*options.DeleteOptions) (deletedCount int64, err error) {
+	return r.Repo.DeleteByID(ctx, id, opts...)
+}
+
+// newDocument returns a zero value of T that is safe to call methods on.
+// If T is a pointer type, the pointed-to value is allocated.
+func newDocument[T any]() T {
+	var doc T
+	if t := reflect.TypeOf(doc); t != nil && t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface().(T)
+	}
+	return doc
+}
@@ -0,0 +1,196 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DuplicateGroup is a set of documents that have the same key in a unique index.
+type DuplicateGroup struct {
+	// Key holds the shared values of the key fields.
+	Key bson.D
+	// IDs are the _id of the documents, from the oldest to the newest by created_at.
+	IDs []interface{}
+}
+
+// DuplicateStrategy selects how duplicates are handled before a unique index is created.
+type DuplicateStrategy int
+
+const (
+	// DuplicatesFail returns a *DuplicatesError without creating the indexes.
+	DuplicatesFail DuplicateStrategy = iota
+	// DuplicatesKeepNewest deletes all the documents of each group but the newest by created_at.
+	DuplicatesKeepNewest
+	// DuplicatesKeepOldest deletes all the documents of each group but the oldest by created_at.
+	DuplicatesKeepOldest
+)
+
+// DuplicatesError is returned by the duplicate check when existing documents violate a unique index.
+type DuplicatesError struct {
+	Index  string
+	Groups []DuplicateGroup
+}
+
+func (e *DuplicatesError) Error() string {
+	return fmt.Sprintf("modm: %d duplicate key group(s) for unique index %s, first %v", len(e.Groups), e.Index, e.Groups[0].Key)
+}
+
+// WithDuplicateCheck returns a context that makes EnsureIndexes, EnsureIndexesByModel and
+// SyncIndexes look for duplicates (see FindDuplicates) before they create a unique index,
+// and handle them with strategy.
+func WithDuplicateCheck(ctx context.Context, strategy DuplicateStrategy) context.Context {
+	return context.WithValue(ctx, ctxKeyDuplicates, strategy)
+}
+
+// FindDuplicates returns the groups of documents that violate a unique index on the given keys.
+// The index may be an index string (see ParseIndex), a key document such as bson.D, or a
+// mongo.IndexModel; its partial filter, sparse option and collation are honored.
+// Array fields are compared as whole values. Soft-deleted documents are included, since the
+// index applies to them as well.
+func (r *Repo[T]) FindDuplicates(ctx context.Context, index interface{}) ([]DuplicateGroup, error) {
+	model, err := indexModelOf(index)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := toBsonD(model.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("modm: index has no keys")
+	}
+	o := model.Options
+	if o == nil {
+		o = options.Index()
+	}
+
+	pipeline := mongo.Pipeline{}
+	if o.PartialFilterExpression != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: o.PartialFilterExpression}})
+	}
+	groupKey := make(bson.D, len(keys))
+	exists := make(bson.A, len(keys))
+	for i, k := range keys {
+		// A unique index does not tell a missing field from null.
+		groupKey[i] = bson.E{Key: fmt.Sprintf("k%d", i), Value: bson.D{{Key: "$ifNull", Value: bson.A{"$" + k.Key, nil}}}}
+		exists[i] = bson.D{{Key: k.Key, Value: bson.D{{Key: "$exists", Value: true}}}}
+	}
+	if o.Sparse != nil && *o.Sparse {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: exists}}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupKey},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	)
+
+	aggOpts := options.Aggregate().SetAllowDiskUse(true)
+	if o.Collation != nil {
+		aggOpts.SetCollation(o.Collation)
+	}
+	var res []struct {
+		Key bson.D        `bson:"_id"`
+		IDs []interface{} `bson:"ids"`
+	}
+	if err := r.Aggregate(ctx, pipeline, &res, aggOpts); err != nil {
+		return nil, err
+	}
+	groups := make([]DuplicateGroup, len(res))
+	for i, g := range res {
+		key := make(bson.D, len(keys))
+		for j, k := range keys {
+			key[j] = bson.E{Key: k.Key}
+			if j < len(g.Key) {
+				key[j].Value = g.Key[j].Value
+			}
+		}
+		groups[i] = DuplicateGroup{Key: key, IDs: g.IDs}
+	}
+	return groups, nil
+}
+
+// ResolveDuplicates permanently deletes all the documents of each group but the newest or the
+// oldest, depending on strategy, and returns the number of deleted documents.
+// Hooks: BeforeDelete, AfterDelete
+func (r *Repo[T]) ResolveDuplicates(ctx context.Context, groups []DuplicateGroup, strategy DuplicateStrategy) (int64, error) {
+	var ids bson.A
+	for _, g := range groups {
+		if len(g.IDs) < 2 {
+			continue
+		}
+		switch strategy {
+		case DuplicatesKeepNewest:
+			ids = append(ids, g.IDs[:len(g.IDs)-1]...)
+		case DuplicatesKeepOldest:
+			ids = append(ids, g.IDs[1:]...)
+		default:
+			return 0, fmt.Errorf("modm: duplicate strategy %d does not resolve duplicates", strategy)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return r.ForceDelete(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+// checkDuplicates looks for the duplicates of the unique indexes of models if the context has
+// a duplicate check (see WithDuplicateCheck), and handles them with its strategy.
+func (r *Repo[T]) checkDuplicates(ctx context.Context, models []mongo.IndexModel) error {
+	strategy, ok := ctx.Value(ctxKeyDuplicates).(DuplicateStrategy)
+	if !ok {
+		return nil
+	}
+	for _, model := range models {
+		if !isUniqueIndex(model) {
+			continue
+		}
+		groups, err := r.FindDuplicates(ctx, model)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		if strategy == DuplicatesFail {
+			return &DuplicatesError{Index: indexName(model), Groups: groups}
+		}
+		if _, err := r.ResolveDuplicates(ctx, groups, strategy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isUniqueIndex(model mongo.IndexModel) bool {
+	return model.Options != nil && model.Options.Unique != nil && *model.Options.Unique
+}
+
+// indexModelOf converts an index string, a key document or a mongo.IndexModel to a mongo.IndexModel.
+func indexModelOf(index interface{}) (mongo.IndexModel, error) {
+	switch index := index.(type) {
+	case string:
+		return ParseIndex(index)
+	case mongo.IndexModel:
+		return index, nil
+	case *mongo.IndexModel:
+		return *index, nil
+	}
+	return mongo.IndexModel{Keys: index}, nil
+}
+
+// indexName returns the name of the index, or the default name of the driver.
+func indexName(model mongo.IndexModel) string {
+	spec, err := declaredIndexSpec(model)
+	if err != nil {
+		return fmt.Sprint(model.Keys)
+	}
+	return spec.Name
+}
@@ -0,0 +1,97 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIndexModelOf(t *testing.T) {
+	model, err := indexModelOf("name,-age:unique")
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, model.Keys)
+	assert.True(t, isUniqueIndex(model))
+	assert.Equal(t, "name_1_age_-1", indexName(model))
+
+	model, err = indexModelOf(bson.D{{Key: "email", Value: 1}})
+	require.NoError(t, err)
+	assert.False(t, isUniqueIndex(model))
+	assert.Equal(t, "email_1", indexName(model))
+
+	_, err = indexModelOf("name:bogus")
+	var syntaxErr *IndexSyntaxError
+	assert.ErrorAs(t, err, &syntaxErr)
+}
+
+func TestDuplicatesError(t *testing.T) {
+	err := &DuplicatesError{Index: "name_1", Groups: []DuplicateGroup{{Key: bson.D{{Key: "name", Value: "a"}}, IDs: []interface{}{1, 2}}}}
+	assert.Equal(t, "modm: 1 duplicate key group(s) for unique index name_1, first [{name a}]", err.Error())
+}
+
+func TestResolveDuplicates_strategy(t *testing.T) {
+	repo := NewRepo[*TestUser](nil)
+	_, err := repo.ResolveDuplicates(context.Background(), []DuplicateGroup{{IDs: []interface{}{1, 2}}}, DuplicatesFail)
+	assert.Error(t, err)
+
+	deleted, err := repo.ResolveDuplicates(context.Background(), []DuplicateGroup{{IDs: []interface{}{1}}}, DuplicatesKeepNewest)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func TestRepo_FindDuplicates(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+	ctx := context.Background()
+
+	now := time.Now()
+	users := []*TestUser{
+		{Name: "Alice", Age: 1},
+		{Name: "alice", Age: 2},
+		{Name: "Bob", Age: 3},
+		{Name: "Bob", Age: 4},
+		{Age: 5},
+		{Age: 6},
+	}
+	for i, u := range users {
+		u.CreatedAt = now.Add(time.Duration(i) * time.Second)
+	}
+	require.NoError(t, repo.InsertMany(ctx, users))
+
+	groups, err := repo.FindDuplicates(ctx, "name")
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	groups, err = repo.FindDuplicates(ctx, "name:sparse")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, bson.D{{Key: "name", Value: "Bob"}}, groups[0].Key)
+	assert.Equal(t, []interface{}{users[2].ID, users[3].ID}, groups[0].IDs)
+
+	groups, err = repo.FindDuplicates(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetCollation(&options.Collation{Locale: "en", Strength: 2}).SetPartialFilterExpression(bson.M{"age": bson.M{"$lt": 3}}),
+	})
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Len(t, groups[0].IDs, 2)
+
+	err = repo.EnsureIndexes(WithDuplicateCheck(ctx, DuplicatesFail), []string{"name:sparse"}, nil)
+	var dupErr *DuplicatesError
+	require.True(t, errors.As(err, &dupErr))
+	assert.Equal(t, "name_1", dupErr.Index)
+
+	err = repo.EnsureIndexes(WithDuplicateCheck(ctx, DuplicatesKeepNewest), []string{"name:sparse"}, nil)
+	require.NoError(t, err)
+	_, err = repo.Get(ctx, users[2].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.Get(ctx, users[3].ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,207 @@
+package modm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when no document matches a FindOne, FindOneAndUpdate,
+// FindOneAndDelete or Get. It is mongo.ErrNoDocuments, so that existing comparisons with the
+// driver error keep working; use errors.Is to also match it when wrapped.
+var ErrNotFound = mongo.ErrNoDocuments
+
+// DuplicateKeyError is returned when a write violates a unique index.
+// It wraps the driver error, so mongo.IsDuplicateKeyError still reports true for it.
+type DuplicateKeyError struct {
+	// IndexName is the name of the violated index.
+	IndexName string
+	// Keys and Values are the key fields of the index and the duplicate values. Keys may be
+	// empty when the server does not report them.
+	Keys   []string
+	Values []interface{}
+	Err    error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	pairs := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		pairs[i] = fmt.Sprintf("%s: %v", key, e.Values[i])
+	}
+	return fmt.Sprintf("modm: duplicate key in index %s: {%s}", e.IndexName, strings.Join(pairs, ", "))
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// WriteFailure is the failed write of a document in a bulk operation.
+type WriteFailure struct {
+	// Index is the position of the document in the operation.
+	Index int
+	// Err is the error of the write, e.g. a *DuplicateKeyError.
+	Err error
+}
+
+// BulkWriteError is returned when writes of a bulk operation (e.g. InsertMany) fail.
+// errors.Is and errors.As match the errors of the failed writes, so that
+// errors.As(err, &dupErr) finds the first *DuplicateKeyError.
+type BulkWriteError struct {
+	Failures []WriteFailure
+	Err      error
+}
+
+func (e *BulkWriteError) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf("modm: bulk write failed: %v", e.Err)
+	}
+	f := e.Failures[0]
+	return fmt.Sprintf("modm: %d write(s) failed, first on document %d: %v", len(e.Failures), f.Index, f.Err)
+}
+
+func (e *BulkWriteError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error of any failed write matches target.
+func (e *BulkWriteError) Is(target error) bool {
+	for _, f := range e.Failures {
+		if errors.Is(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the failed writes that matches target.
+func (e *BulkWriteError) As(target interface{}) bool {
+	for _, f := range e.Failures {
+		if errors.As(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapError converts driver errors into the errors of this package.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		if len(writeErr.WriteErrors) == 1 && isDuplicateKeyCode(writeErr.WriteErrors[0].Code) {
+			we := writeErr.WriteErrors[0]
+			return newDuplicateKeyError(we.Message, we.Raw, err)
+		}
+		return err
+	}
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		if len(bulkErr.WriteErrors) == 0 {
+			return err
+		}
+		failures := make([]WriteFailure, len(bulkErr.WriteErrors))
+		for i, we := range bulkErr.WriteErrors {
+			failures[i] = WriteFailure{Index: we.Index, Err: we.WriteError}
+			if isDuplicateKeyCode(we.Code) {
+				failures[i].Err = newDuplicateKeyError(we.Message, we.Raw, we.WriteError)
+			}
+		}
+		return &BulkWriteError{Failures: failures, Err: err}
+	}
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && isDuplicateKeyCode(int(cmdErr.Code)) {
+		return newDuplicateKeyError(cmdErr.Message, cmdErr.Raw, err)
+	}
+	return err
+}
+
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
+
+var (
+	dupIndexRe = regexp.MustCompile(`index: (\S+)`)
+	dupKeyRe   = regexp.MustCompile(`dup key: \{ ?(.*?) ?\}(?:,? collation: .*)?$`)
+)
+
+// newDuplicateKeyError builds a DuplicateKeyError from the keyValue field of the raw server
+// error if present, or else from the error message:
+// E11000 duplicate key error collection: db.users index: name_1 dup key: { name: "go" }
+func newDuplicateKeyError(message string, raw bson.Raw, err error) *DuplicateKeyError {
+	e := &DuplicateKeyError{Err: err}
+	if m := dupIndexRe.FindStringSubmatch(message); m != nil {
+		e.IndexName = m[1]
+	}
+	if keyValue, ok := raw.Lookup("keyValue").DocumentOK(); ok {
+		elems, _ := keyValue.Elements()
+		for _, elem := range elems {
+			var value interface{}
+			_ = elem.Value().Unmarshal(&value)
+			e.Keys = append(e.Keys, elem.Key())
+			e.Values = append(e.Values, value)
+		}
+		return e
+	}
+	if m := dupKeyRe.FindStringSubmatch(message); m != nil {
+		for _, pair := range splitDupKey(m[1]) {
+			key, value := pair, ""
+			if i := strings.Index(pair, ": "); i >= 0 {
+				key, value = pair[:i], pair[i+2:]
+			}
+			e.Keys = append(e.Keys, strings.TrimSpace(key))
+			e.Values = append(e.Values, parseDupValue(value))
+		}
+	}
+	return e
+}
+
+// splitDupKey splits the fields of a dup key message on top-level commas.
+func splitDupKey(s string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// parseDupValue parses a value of a dup key message; values that are not strings or numbers
+// (e.g. ObjectId('...')) are returned as they are printed.
+func parseDupValue(s string) interface{} {
+	if v, err := strconv.Unquote(s); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWrapError(t *testing.T) {
+	assert.Nil(t, wrapError(nil))
+	assert.True(t, wrapError(mongo.ErrNoDocuments) == mongo.ErrNoDocuments)
+	assert.ErrorIs(t, wrapError(mongo.ErrNoDocuments), ErrNotFound)
+	assert.Equal(t, ErrVersionConflict, wrapError(ErrVersionConflict))
+
+	raw, err := bson.Marshal(bson.D{
+		{Key: "code", Value: 11000},
+		{Key: "keyValue", Value: bson.D{{Key: "name", Value: "go"}, {Key: "age", Value: int32(2)}}},
+	})
+	require.NoError(t, err)
+	writeErr := mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: test.users index: name_1_age_1 dup key: { name: "go", age: 2 }`,
+		Raw:     raw,
+	}}}
+	var dupErr *DuplicateKeyError
+	require.ErrorAs(t, wrapError(writeErr), &dupErr)
+	assert.Equal(t, "name_1_age_1", dupErr.IndexName)
+	assert.Equal(t, []string{"name", "age"}, dupErr.Keys)
+	assert.Equal(t, []interface{}{"go", int32(2)}, dupErr.Values)
+	assert.True(t, mongo.IsDuplicateKeyError(dupErr))
+
+	bulkErr := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: `E11000 duplicate key error collection: test.users index: uid_1 dup key: { uid: ObjectId('64d5fd0cfd4a5b3cdb1b9e29') }`}},
+		{WriteError: mongo.WriteError{Index: 3, Code: 121, Message: "Document failed validation"}},
+	}}
+	var bwErr *BulkWriteError
+	err = wrapError(bulkErr)
+	require.ErrorAs(t, err, &bwErr)
+	require.Len(t, bwErr.Failures, 2)
+	assert.Equal(t, 1, bwErr.Failures[0].Index)
+	assert.Equal(t, 3, bwErr.Failures[1].Index)
+	require.ErrorAs(t, err, &dupErr)
+	assert.Equal(t, "uid_1", dupErr.IndexName)
+	assert.Equal(t, []interface{}{"ObjectId('64d5fd0cfd4a5b3cdb1b9e29')"}, dupErr.Values)
+
+	cmdErr := mongo.CommandError{Code: 11000, Message: `E11000 duplicate key error collection: test.users index: name_1 dup key: { name: "a, \"b\"" }, collation: { locale: "en" }`}
+	require.ErrorAs(t, wrapError(cmdErr), &dupErr)
+	assert.Equal(t, []string{"name"}, dupErr.Keys)
+	assert.Equal(t, []interface{}{`a, "b"`}, dupErr.Values)
+
+	other := errors.New("other")
+	assert.Equal(t, other, wrapError(other))
+}
+
+func TestRepo_Errors(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	require.NoError(t, repo.EnsureIndexes(ctx, []string{"name"}, nil))
+	_, err := repo.InsertOne(ctx, &TestUser{Name: "go", Age: 2})
+	require.NoError(t, err)
+
+	_, err = repo.InsertOne(ctx, &TestUser{Name: "go", Age: 3})
+	var dupErr *DuplicateKeyError
+	require.ErrorAs(t, err, &dupErr)
+	assert.Equal(t, "name_1", dupErr.IndexName)
+	assert.Equal(t, []string{"name"}, dupErr.Keys)
+	assert.Equal(t, []interface{}{"go"}, dupErr.Values)
+
+	err = repo.InsertMany(ctx, []*TestUser{{Name: "goo"}, {Name: "go"}}, options.InsertMany().SetOrdered(false))
+	var bulkErr *BulkWriteError
+	require.ErrorAs(t, err, &bulkErr)
+	require.Len(t, bulkErr.Failures, 1)
+	assert.Equal(t, 1, bulkErr.Failures[0].Index)
+	require.ErrorAs(t, err, &dupErr)
+
+	_, err = repo.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.FindOneAndDelete(ctx, bson.M{"name": "missing"})
+	require.ErrorIs(t, err, ErrNotFound)
+}
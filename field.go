@@ -9,67 +9,83 @@ import (
 )
 
 // DefaultField represents a structure with default fields for MongoDB documents.
-type DefaultField struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+type DefaultField = DefaultFieldOf[primitive.ObjectID]
+
+// DefaultFieldOf is DefaultField with an _id of type ID, e.g. DefaultFieldOf[string].
+// A zero ID is set on insert by the generator registered for ID with RegisterIDGenerator.
+type DefaultFieldOf[ID comparable] struct {
+	ID        ID        `bson:"_id,omitempty" json:"_id"`
+	CreatedAt time.Time `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// SetID sets the _id field to an ObjectID. It has no effect unless ID is primitive.ObjectID;
+// use SetIDOf for other ID types.
+func (df *DefaultFieldOf[ID]) SetID(id primitive.ObjectID) {
+	if v, ok := interface{}(id).(ID); ok {
+		df.ID = v
+	}
 }
 
-func (df *DefaultField) SetID(id primitive.ObjectID) {
+// SetIDOf sets the _id field.
+func (df *DefaultFieldOf[ID]) SetIDOf(id ID) {
 	df.ID = id
 }
 
 // DefaultUpdatedAt sets the default value for the UpdatedAt field.
-func (df *DefaultField) DefaultUpdatedAt() {
+func (df *DefaultFieldOf[ID]) DefaultUpdatedAt() {
 	df.UpdatedAt = time.Now()
 }
 
 // DefaultCreatedAt sets the default value for the CreatedAt field if it's zero.
-func (df *DefaultField) DefaultCreatedAt() {
+func (df *DefaultFieldOf[ID]) DefaultCreatedAt() {
 	if df.CreatedAt.IsZero() {
 		df.CreatedAt = time.Now()
 	}
 }
 
-// DefaultID sets the default value for the _id field if it's zero.
-func (df *DefaultField) DefaultID() {
-	if df.ID.IsZero() {
-		df.ID = primitive.NewObjectID()
+// DefaultID sets the default value for the _id field if it's zero and a generator is registered for ID.
+func (df *DefaultFieldOf[ID]) DefaultID() {
+	var zero ID
+	if df.ID == zero {
+		if id, ok := generateID[ID](); ok {
+			df.ID = id
+		}
 	}
 }
 
 // BeforeInsert is a hook to set default field values before inserting a document.
-func (df *DefaultField) BeforeInsert(ctx context.Context) {
+func (df *DefaultFieldOf[ID]) BeforeInsert(ctx context.Context) {
 	df.DefaultID()
 	df.DefaultCreatedAt()
 	df.DefaultUpdatedAt()
 }
 
 // AfterInsert is a hook to handle actions after inserting a document.
-func (df *DefaultField) AfterInsert(ctx context.Context) {}
+func (df *DefaultFieldOf[ID]) AfterInsert(ctx context.Context) {}
 
 // BeforeUpdate is a hook to set default field values before updating a document.
-func (df *DefaultField) BeforeUpdate(ctx context.Context) {
+func (df *DefaultFieldOf[ID]) BeforeUpdate(ctx context.Context) {
 	df.DefaultUpdatedAt()
 }
 
 // AfterUpdate is a hook to handle actions after updating a document.
-func (df *DefaultField) AfterUpdate(ctx context.Context) {}
+func (df *DefaultFieldOf[ID]) AfterUpdate(ctx context.Context) {}
 
 // AfterFind is a hook to handle actions after finding a document.
-func (df *DefaultField) AfterFind(ctx context.Context) {}
+func (df *DefaultFieldOf[ID]) AfterFind(ctx context.Context) {}
 
 // Uniques returns the unique indexes for the collection.
-func (df *DefaultField) Uniques() []string {
+func (df *DefaultFieldOf[ID]) Uniques() []string {
 	return []string{}
 }
 
 // Indexes returns the non-unique indexes for the collection.
-func (df *DefaultField) Indexes() []string {
+func (df *DefaultFieldOf[ID]) Indexes() []string {
 	return []string{}
 }
 
 // Indexes returns the non-unique indexes for the collection.
-func (df *DefaultField) IndexModels() []mongo.IndexModel {
+func (df *DefaultFieldOf[ID]) IndexModels() []mongo.IndexModel {
 	return []mongo.IndexModel{}
 }
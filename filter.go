@@ -0,0 +1,198 @@
+package modm
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Filter is a query filter builder bound to the document type T.
+// Fields are given either as bson paths ("age", "profile.city") or as pointers to the fields of
+// Model[T](), and are checked against T when the filter is built:
+//
+//	u := modm.Model[*User]()
+//	filter := modm.Where[*User]().Eq(&u.Age, 0).Or(
+//		modm.Where[*User]().Gt(&u.CreatedAt, since),
+//		modm.Where[*User]().Exists("email", true),
+//	)
+//	users, err := db.Users.Find(ctx, filter)
+//
+// A Filter can be passed to every Repo method that takes a filter. Unknown fields make
+// Build, and therefore the operation, fail.
+type Filter[T Document] struct {
+	fields []filterField
+	logic  bson.D
+	err    error
+}
+
+type filterField struct {
+	path string
+	ops  bson.D
+}
+
+// Where starts a filter for documents of type T.
+func Where[T Document]() *Filter[T] {
+	return &Filter[T]{}
+}
+
+func (f *Filter[T]) field(field interface{}, op string, value interface{}) *Filter[T] {
+	if f.err != nil {
+		return f
+	}
+	path, _, err := resolveField[T](field)
+	if err != nil {
+		f.err = err
+		return f
+	}
+	for i := range f.fields {
+		if f.fields[i].path == path {
+			f.fields[i].ops = append(f.fields[i].ops, bson.E{Key: op, Value: value})
+			return f
+		}
+	}
+	f.fields = append(f.fields, filterField{path: path, ops: bson.D{{Key: op, Value: value}}})
+	return f
+}
+
+func (f *Filter[T]) logical(op string, filters []*Filter[T]) *Filter[T] {
+	if f.err != nil {
+		return f
+	}
+	list := make(bson.A, 0, len(filters))
+	for _, filter := range filters {
+		d, err := filter.Build()
+		if err != nil {
+			f.err = err
+			return f
+		}
+		list = append(list, d)
+	}
+	f.logic = append(f.logic, bson.E{Key: op, Value: list})
+	return f
+}
+
+// Eq matches documents where the field equals value ($eq).
+func (f *Filter[T]) Eq(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$eq", value)
+}
+
+// Ne matches documents where the field does not equal value ($ne).
+func (f *Filter[T]) Ne(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$ne", value)
+}
+
+// Gt matches documents where the field is greater than value ($gt).
+func (f *Filter[T]) Gt(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$gt", value)
+}
+
+// Gte matches documents where the field is greater than or equal to value ($gte).
+func (f *Filter[T]) Gte(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$gte", value)
+}
+
+// Lt matches documents where the field is less than value ($lt).
+func (f *Filter[T]) Lt(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$lt", value)
+}
+
+// Lte matches documents where the field is less than or equal to value ($lte).
+func (f *Filter[T]) Lte(field interface{}, value interface{}) *Filter[T] {
+	return f.field(field, "$lte", value)
+}
+
+// In matches documents where the field equals any of the values ($in).
+func (f *Filter[T]) In(field interface{}, values ...interface{}) *Filter[T] {
+	return f.field(field, "$in", bson.A(values))
+}
+
+// Nin matches documents where the field equals none of the values ($nin).
+func (f *Filter[T]) Nin(field interface{}, values ...interface{}) *Filter[T] {
+	return f.field(field, "$nin", bson.A(values))
+}
+
+// Not matches documents that do not match the operator expression, e.g. bson.M{"$gt": 5} ($not).
+func (f *Filter[T]) Not(field interface{}, expr interface{}) *Filter[T] {
+	return f.field(field, "$not", expr)
+}
+
+// Exists matches documents that have (or do not have) the field ($exists).
+func (f *Filter[T]) Exists(field interface{}, exists bool) *Filter[T] {
+	return f.field(field, "$exists", exists)
+}
+
+// Type matches documents where the field is of the given BSON type(s) ($type).
+func (f *Filter[T]) Type(field interface{}, types ...interface{}) *Filter[T] {
+	if len(types) == 1 {
+		return f.field(field, "$type", types[0])
+	}
+	return f.field(field, "$type", bson.A(types))
+}
+
+// Regex matches documents where the field matches the regular expression ($regex).
+func (f *Filter[T]) Regex(field interface{}, pattern string, options string) *Filter[T] {
+	f.field(field, "$regex", pattern)
+	if options != "" {
+		f.field(field, "$options", options)
+	}
+	return f
+}
+
+// Mod matches documents where field % divisor == remainder ($mod).
+func (f *Filter[T]) Mod(field interface{}, divisor int64, remainder int64) *Filter[T] {
+	return f.field(field, "$mod", bson.A{divisor, remainder})
+}
+
+// All matches array fields that contain all of the values ($all).
+func (f *Filter[T]) All(field interface{}, values ...interface{}) *Filter[T] {
+	return f.field(field, "$all", bson.A(values))
+}
+
+// ElemMatch matches array fields with at least one element that matches the query ($elemMatch).
+func (f *Filter[T]) ElemMatch(field interface{}, query interface{}) *Filter[T] {
+	return f.field(field, "$elemMatch", query)
+}
+
+// Size matches array fields with the given number of elements ($size).
+func (f *Filter[T]) Size(field interface{}, size int) *Filter[T] {
+	return f.field(field, "$size", size)
+}
+
+// And matches documents that match all of the filters ($and).
+func (f *Filter[T]) And(filters ...*Filter[T]) *Filter[T] {
+	return f.logical("$and", filters)
+}
+
+// Or matches documents that match any of the filters ($or).
+func (f *Filter[T]) Or(filters ...*Filter[T]) *Filter[T] {
+	return f.logical("$or", filters)
+}
+
+// Nor matches documents that match none of the filters ($nor).
+func (f *Filter[T]) Nor(filters ...*Filter[T]) *Filter[T] {
+	return f.logical("$nor", filters)
+}
+
+// Err returns the first error recorded while building the filter.
+func (f *Filter[T]) Err() error {
+	return f.err
+}
+
+// Build returns the filter document, or the first error recorded while building it.
+func (f *Filter[T]) Build() (bson.D, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	d := make(bson.D, 0, len(f.fields)+len(f.logic))
+	for _, field := range f.fields {
+		d = append(d, bson.E{Key: field.path, Value: field.ops})
+	}
+	return append(d, f.logic...), nil
+}
+
+// MarshalBSON implements bson.Marshaler, so that a Filter can be used as a filter document.
+func (f *Filter[T]) MarshalBSON() ([]byte, error) {
+	d, err := f.Build()
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(d)
+}
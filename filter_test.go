@@ -0,0 +1,75 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFilter(t *testing.T) {
+	u := Model[*TestProfile]()
+	filter, err := Where[*TestProfile]().
+		Eq(&u.Age, 0).
+		Gt(&u.Score, 1.5).
+		Lte(&u.Score, 9).
+		In(&u.Tags, "go", "mongo").
+		Exists(&u.Nickname, false).
+		Or(
+			Where[*TestProfile]().Regex(&u.Name, "^go", "i"),
+			Where[*TestProfile]().Size("addresses", 2),
+		).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "age", Value: bson.D{{Key: "$eq", Value: 0}}},
+		{Key: "score", Value: bson.D{{Key: "$gt", Value: 1.5}, {Key: "$lte", Value: 9}}},
+		{Key: "tags", Value: bson.D{{Key: "$in", Value: bson.A{"go", "mongo"}}}},
+		{Key: "nickname", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^go"}, {Key: "$options", Value: "i"}}}},
+			bson.D{{Key: "addresses", Value: bson.D{{Key: "$size", Value: 2}}}},
+		}},
+	}, filter)
+
+	empty, err := Where[*TestProfile]().Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{}, empty)
+}
+
+func TestFilter_Error(t *testing.T) {
+	filter := Where[*TestProfile]().Eq("name", "go").Ne("nmae", "go").Eq("age", 1)
+	assert.Error(t, filter.Err())
+	_, err := filter.Build()
+	assert.ErrorContains(t, err, "nmae")
+	_, err = bson.Marshal(filter)
+	assert.Error(t, err)
+
+	_, err = Where[*TestProfile]().Or(Where[*TestProfile]().Eq("unknown", 1)).Build()
+	assert.Error(t, err)
+}
+
+func TestRepo_FindByFilter(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.InsertMany(ctx, []*TestUser{{Name: "go", Age: 2}, {Name: "goo", Age: 3}, {Name: "gooo"}})
+	require.NoError(t, err)
+
+	u := Model[*TestUser]()
+	users, err := repo.Find(ctx, Where[*TestUser]().Gte(&u.Age, 2).Lt(&u.Age, 3))
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "go", users[0].Name)
+
+	count, err := repo.Count(ctx, Where[*TestUser]().Exists(&u.Age, false))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = repo.Find(ctx, Where[*TestUser]().Eq("unknown", 1))
+	require.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BeforeInsertHook is an opt-in hook that can abort an insert by returning an error.
+// It runs after Document.BeforeInsert, so default field values are already set.
+type BeforeInsertHook interface {
+	BeforeInsertE(ctx context.Context) error
+}
+
+// AfterInsertHook is an opt-in hook that reports a failure after a successful insert.
+type AfterInsertHook interface {
+	AfterInsertE(ctx context.Context) error
+}
+
+// BeforeUpdateHook is an opt-in hook that can abort an update by returning an error.
+// It runs after Document.BeforeUpdate.
+type BeforeUpdateHook interface {
+	BeforeUpdateE(ctx context.Context) error
+}
+
+// AfterUpdateHook is an opt-in hook that reports a failure after a successful update.
+type AfterUpdateHook interface {
+	AfterUpdateE(ctx context.Context) error
+}
+
+// AfterFindHook is an opt-in hook that reports a failure after a document has been decoded.
+type AfterFindHook interface {
+	AfterFindE(ctx context.Context) error
+}
+
+// HookError is returned when an error-returning hook fails.
+// Index is the position of the document in the operation (always 0 for single-document operations).
+type HookError struct {
+	Hook  string
+	Index int
+	Err   error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("modm: %s hook failed on document %d: %v", e.Hook, e.Index, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+func runBeforeInsert(ctx context.Context, doc interface{}, index int) error {
+	if h, ok := doc.(BeforeInsertHook); ok {
+		if err := h.BeforeInsertE(ctx); err != nil {
+			return &HookError{Hook: "BeforeInsertE", Index: index, Err: err}
+		}
+	}
+	return nil
+}
+
+func runAfterInsert(ctx context.Context, doc interface{}, index int) error {
+	if h, ok := doc.(AfterInsertHook); ok {
+		if err := h.AfterInsertE(ctx); err != nil {
+			return &HookError{Hook: "AfterInsertE", Index: index, Err: err}
+		}
+	}
+	return nil
+}
+
+func runBeforeUpdate(ctx context.Context, doc interface{}, index int) error {
+	if h, ok := doc.(BeforeUpdateHook); ok {
+		if err := h.BeforeUpdateE(ctx); err != nil {
+			return &HookError{Hook: "BeforeUpdateE", Index: index, Err: err}
+		}
+	}
+	return nil
+}
+
+func runAfterUpdate(ctx context.Context, doc interface{}, index int) error {
+	if h, ok := doc.(AfterUpdateHook); ok {
+		if err := h.AfterUpdateE(ctx); err != nil {
+			return &HookError{Hook: "AfterUpdateE", Index: index, Err: err}
+		}
+	}
+	return nil
+}
+
+func runAfterFind(ctx context.Context, doc interface{}, index int) error {
+	if h, ok := doc.(AfterFindHook); ok {
+		if err := h.AfterFindE(ctx); err != nil {
+			return &HookError{Hook: "AfterFindE", Index: index, Err: err}
+		}
+	}
+	return nil
+}
+
+// DeleteEvent describes a delete operation passed to BeforeDelete and AfterDelete hooks.
+type DeleteEvent[T Document] struct {
+	// Filter is the filter passed to the delete operation.
+	Filter interface{}
+	// Docs holds the documents being removed. It is populated when the context was created
+	// with WithDeletedDocs, and for AfterDelete of FindOneAndDelete.
+	Docs []T
+	// DeletedCount is the number of removed documents. It is only set for AfterDelete.
+	DeletedCount int64
+}
+
+// BeforeDeleteHook is an opt-in hook that can abort a delete by returning an error.
+// The hook is called on each document of DeleteEvent.Docs, or once on a zero value of T if the
+// documents are not loaded.
+type BeforeDeleteHook[T Document] interface {
+	BeforeDelete(ctx context.Context, event *DeleteEvent[T]) error
+}
+
+// AfterDeleteHook is an opt-in hook that runs after a successful delete.
+// The hook is called on each document of DeleteEvent.Docs, or once on a zero value of T if the
+// documents are not loaded.
+type AfterDeleteHook[T Document] interface {
+	AfterDelete(ctx context.Context, event *DeleteEvent[T]) error
+}
+
+// beforeDelete builds the DeleteEvent of a delete operation and runs the BeforeDelete hook.
+// If the context was created with WithDeletedDocs, the documents that the delete would remove
+// are loaded through the interceptors as an OpFind, with the find options (limit, sort,
+// collation and hint of the delete), and the returned filter selects exactly those documents by
+// _id. The documents are decoded without running AfterFind hooks or populating references.
+func (r *Repo[T]) beforeDelete(ctx context.Context, filter interface{}, find *options.FindOptions) (*DeleteEvent[T], interface{}, error) {
+	event := &DeleteEvent[T]{Filter: filter}
+	if ctxFlag(ctx, ctxKeyDeletedDocs) {
+		scoped := r.scope(ctx, filter)
+		if r.softDeleting(ctx) {
+			scoped = r.scope(context.Background(), filter)
+		}
+		op := &Op{Kind: OpFind, Filter: scoped, Options: []*options.FindOptions{find}}
+		if err := r.invoke(ctx, op, r.find); err != nil {
+			return nil, nil, err
+		}
+		docs, _ := op.Result.([]T)
+		ids := make(bson.A, 0, len(docs))
+		for _, doc := range docs {
+			id, err := documentID(doc)
+			if err != nil {
+				return nil, nil, err
+			}
+			ids = append(ids, id)
+		}
+		event.Docs = docs
+		filter = bson.M{"_id": bson.M{"$in": ids}}
+	}
+	for i, doc := range deleteHookTargets(event) {
+		if h, ok := interface{}(doc).(BeforeDeleteHook[T]); ok {
+			if err := h.BeforeDelete(ctx, event); err != nil {
+				return nil, nil, &HookError{Hook: "BeforeDelete", Index: i, Err: err}
+			}
+		}
+	}
+	return event, filter, nil
+}
+
+// afterDelete runs the AfterDelete hook.
+func (r *Repo[T]) afterDelete(ctx context.Context, event *DeleteEvent[T], deletedCount int64) error {
+	event.DeletedCount = deletedCount
+	for i, doc := range deleteHookTargets(event) {
+		if h, ok := interface{}(doc).(AfterDeleteHook[T]); ok {
+			if err := h.AfterDelete(ctx, event); err != nil {
+				return &HookError{Hook: "AfterDelete", Index: i, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// deleteHookTargets returns the documents that the delete hooks are called on: the documents of
+// the event, or else a zero value of T.
+func deleteHookTargets[T Document](event *DeleteEvent[T]) []T {
+	if len(event.Docs) > 0 {
+		return event.Docs
+	}
+	return []T{newDocument[T]()}
+}
+
+// deleteFindOptions returns the options that load the documents removed by a delete.
+func deleteFindOptions(opts []*options.DeleteOptions, limit int64) *options.FindOptions {
+	fo := options.Find().SetLimit(limit)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Collation != nil {
+			fo.SetCollation(opt.Collation)
+		}
+		if opt.Hint != nil {
+			fo.SetHint(opt.Hint)
+		}
+		if opt.Let != nil {
+			fo.SetLet(opt.Let)
+		}
+	}
+	return fo
+}
+
+// findOneAndDeleteFindOptions returns the options that load the document removed by a FindOneAndDelete.
+func findOneAndDeleteFindOptions(opts []*options.FindOneAndDeleteOptions) *options.FindOptions {
+	fo := options.Find().SetLimit(1)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Collation != nil {
+			fo.SetCollation(opt.Collation)
+		}
+		if opt.Hint != nil {
+			fo.SetHint(opt.Hint)
+		}
+		if opt.Let != nil {
+			fo.SetLet(opt.Let)
+		}
+		if opt.Sort != nil {
+			fo.SetSort(opt.Sort)
+		}
+	}
+	return fo
+}
+
+// documentID returns the _id of an encoded document.
+func documentID(doc interface{}) (bson.RawValue, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+	return bson.Raw(raw).LookupErr("_id")
+}
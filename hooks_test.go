@@ -0,0 +1,170 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInvalidName = errors.New("invalid name")
+
+type TestHookUser struct {
+	DefaultField `bson:",inline"`
+	Name         string `bson:"name,omitempty" json:"name"`
+	Age          uint   `bson:"age,omitempty" json:"age"`
+	Found        bool   `bson:"-" json:"-"`
+}
+
+func (u *TestHookUser) BeforeInsertE(ctx context.Context) error {
+	if u.Name == "" {
+		return errInvalidName
+	}
+	return nil
+}
+
+func (u *TestHookUser) BeforeUpdateE(ctx context.Context) error {
+	if u.Name == "root" {
+		return errInvalidName
+	}
+	return nil
+}
+
+func (u *TestHookUser) AfterFindE(ctx context.Context) error {
+	if u.Age > 100 {
+		return errors.New("age out of range")
+	}
+	u.Found = true
+	return nil
+}
+
+func TestHookError(t *testing.T) {
+	err := &HookError{Hook: "BeforeInsertE", Index: 2, Err: errInvalidName}
+	assert.Equal(t, "modm: BeforeInsertE hook failed on document 2: invalid name", err.Error())
+	assert.ErrorIs(t, err, errInvalidName)
+}
+
+func TestRepo_Hooks(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestHookUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	_, err := repo.InsertOne(ctx, &TestHookUser{Age: 1})
+	var hookErr *HookError
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, "BeforeInsertE", hookErr.Hook)
+	assert.Equal(t, 0, hookErr.Index)
+	assert.ErrorIs(t, err, errInvalidName)
+
+	err = repo.InsertMany(ctx, []*TestHookUser{{Name: "go", Age: 2}, {Age: 3}})
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, 1, hookErr.Index)
+	count, err := repo.Count(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	err = repo.InsertMany(ctx, []*TestHookUser{{Name: "go", Age: 2}, {Name: "old", Age: 101}})
+	require.NoError(t, err)
+
+	_, err = repo.UpdateOne(ctx, bson.M{"name": "go"}, &TestHookUser{Name: "root"})
+	require.ErrorIs(t, err, errInvalidName)
+	_, err = repo.FindOneAndUpdate(ctx, bson.M{"name": "go"}, &TestHookUser{Name: "root"})
+	require.ErrorIs(t, err, errInvalidName)
+
+	user, err := repo.FindOne(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.True(t, user.Found)
+
+	_, err = repo.FindOne(ctx, bson.M{"name": "old"})
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, "AfterFindE", hookErr.Hook)
+
+	_, err = repo.Find(ctx, bson.M{})
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, 1, hookErr.Index)
+}
+
+var errProtected = errors.New("protected document")
+
+var deletedNames []string
+
+func (u *TestHookUser) BeforeDelete(ctx context.Context, event *DeleteEvent[*TestHookUser]) error {
+	if u.Name == "admin" {
+		return errProtected
+	}
+	return nil
+}
+
+func (u *TestHookUser) AfterDelete(ctx context.Context, event *DeleteEvent[*TestHookUser]) error {
+	// Without loaded documents, the hook runs on a zero value.
+	if u.Name != "" {
+		deletedNames = append(deletedNames, u.Name)
+	}
+	return nil
+}
+
+func TestRepo_DeleteHooks(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestHookUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.InsertMany(ctx, []*TestHookUser{{Name: "go", Age: 2}, {Name: "admin", Age: 3}, {Name: "goo", Age: 4}})
+	require.NoError(t, err)
+
+	deletedNames = nil
+	var finds int
+	repo.Use(func(ctx context.Context, op *Op, next Handler) error {
+		if op.Kind == OpFind {
+			finds++
+		}
+		return next(ctx, op)
+	})
+	_, err = repo.DeleteMany(WithDeletedDocs(ctx), bson.M{"age": bson.M{"$gte": 3}})
+	require.ErrorIs(t, err, errProtected)
+	var hookErr *HookError
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, 0, hookErr.Index)
+	// The documents are loaded through the interceptors.
+	assert.Equal(t, 1, finds)
+	count, err := repo.Count(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	deletedCount, err := repo.DeleteOne(WithDeletedDocs(ctx), bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deletedCount)
+	assert.Equal(t, []string{"go"}, deletedNames)
+
+	// Without WithDeletedDocs the hooks only see the filter.
+	deletedCount, err = repo.DeleteMany(ctx, bson.M{"name": "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deletedCount)
+	assert.Equal(t, []string{"go"}, deletedNames)
+
+	doc, err := repo.FindOneAndDelete(ctx, bson.M{"name": "goo"})
+	require.NoError(t, err)
+	assert.Equal(t, "goo", doc.Name)
+	assert.Equal(t, []string{"go", "goo"}, deletedNames)
+
+	_, err = repo.FindOneAndDelete(ctx, bson.M{"name": "404"})
+	require.Error(t, err)
+
+	// The deleted documents are loaded with the sort of the delete, without AfterFind hooks.
+	err = repo.InsertMany(ctx, []*TestHookUser{{Name: "young", Age: 5}, {Name: "adult", Age: 30}, {Name: "old", Age: 101}})
+	require.NoError(t, err)
+	deletedNames = nil
+	doc, err = repo.FindOneAndDelete(WithDeletedDocs(ctx), bson.M{"age": bson.M{"$lte": 100}}, options.FindOneAndDelete().SetSort(bson.M{"age": -1}))
+	require.NoError(t, err)
+	assert.Equal(t, "adult", doc.Name)
+	assert.Equal(t, []string{"adult"}, deletedNames)
+	deletedCount, err = repo.DeleteOne(WithDeletedDocs(ctx), bson.M{"name": "old"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deletedCount)
+	assert.Equal(t, []string{"adult", "old"}, deletedNames)
+}
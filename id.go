@@ -0,0 +1,131 @@
+package modm
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var idGenerators sync.Map // map[reflect.Type]func() interface{}
+
+func init() {
+	RegisterIDGenerator(primitive.NewObjectID)
+}
+
+// RegisterIDGenerator sets the generator of the _id values of type ID, used by
+// DefaultFieldOf[ID] to fill a zero ID on insert. primitive.NewObjectID is registered for
+// primitive.ObjectID; other ID types have no generator unless one is registered:
+//
+//	modm.RegisterIDGenerator(modm.NewULID) // DefaultFieldOf[string]
+func RegisterIDGenerator[ID comparable](gen func() ID) {
+	idGenerators.Store(reflect.TypeOf((*ID)(nil)).Elem(), func() interface{} { return gen() })
+}
+
+// generateID returns a new ID from the generator registered for ID.
+func generateID[ID comparable]() (ID, bool) {
+	gen, ok := idGenerators.Load(reflect.TypeOf((*ID)(nil)).Elem())
+	if !ok {
+		var zero ID
+		return zero, false
+	}
+	return gen.(func() interface{})().(ID), true
+}
+
+// NewUUIDv4 returns a random UUID (version 4) in its canonical string form.
+func NewUUIDv4() string {
+	var u [16]byte
+	randomBytes(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+// NewUUIDv7 returns a time-ordered UUID (version 7) in its canonical string form.
+func NewUUIDv7() string {
+	var u [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(u[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(u[2:], uint32(ms))
+	randomBytes(u[6:])
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID: a 48-bit millisecond timestamp followed by 80 random bits, encoded
+// as 26 characters of Crockford's base32, so that IDs sort by creation time.
+func NewULID() string {
+	var u [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(u[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(u[2:], uint32(ms))
+	randomBytes(u[6:])
+
+	// 128 bits in 26 characters of 5 bits, with 2 leading zero bits.
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// setDocumentID sets the _id of doc to the id assigned on insert. An ObjectID is set with SetID;
+// other IDs, unless the _id is already set, with a SetIDOf method accepting id, or else by
+// assigning the _id field.
+func setDocumentID(doc Document, id interface{}) {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		doc.SetID(oid)
+		return
+	}
+	v := reflect.ValueOf(doc)
+	idValue := reflect.ValueOf(id)
+	if v.Kind() != reflect.Ptr || v.IsNil() || !idValue.IsValid() {
+		return
+	}
+	var fv reflect.Value
+	if v.Elem().Kind() == reflect.Struct {
+		if field, ok := getStructInfo(v.Elem().Type()).byName["_id"]; ok {
+			fv, _ = v.Elem().FieldByIndexErr(field.Index)
+		}
+	}
+	if fv.IsValid() && !fv.IsZero() {
+		return
+	}
+	if m := v.MethodByName("SetIDOf"); m.IsValid() && m.Type().NumIn() == 1 && idValue.Type().AssignableTo(m.Type().In(0)) {
+		m.Call([]reflect.Value{idValue})
+		return
+	}
+	if fv.IsValid() && fv.CanSet() && idValue.Type().AssignableTo(fv.Type()) {
+		fv.Set(idValue)
+	}
+}
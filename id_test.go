@@ -0,0 +1,114 @@
+package modm
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testOrderID string
+
+type TestOrder struct {
+	DefaultFieldOf[testOrderID] `bson:",inline"`
+	Total                       int64 `bson:"total" json:"total"`
+}
+
+type TestCounterDoc struct {
+	DefaultFieldOf[int64] `bson:",inline"`
+	Name                  string `bson:"name" json:"name"`
+}
+
+func TestIDGenerators(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	v4 := NewUUIDv4()
+	assert.Equal(t, "4", uuid.FindStringSubmatch(v4)[1])
+	assert.NotEqual(t, v4, NewUUIDv4())
+	v7 := NewUUIDv7()
+	assert.Equal(t, "7", uuid.FindStringSubmatch(v7)[1])
+
+	ulid := NewULID()
+	assert.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, ulid)
+	assert.NotEqual(t, ulid, NewULID())
+	assert.LessOrEqual(t, ulid[:10], NewULID()[:10])
+}
+
+func TestDefaultFieldOf(t *testing.T) {
+	ctx := context.TODO()
+	df := DefaultFieldOf[int64]{}
+	df.BeforeInsert(ctx)
+	assert.Zero(t, df.ID)
+
+	RegisterIDGenerator(func() testOrderID { return testOrderID(NewULID()) })
+	order := &TestOrder{}
+	order.BeforeInsert(ctx)
+	assert.Len(t, order.ID, 26)
+
+	oid := DefaultField{}
+	oid.BeforeInsert(ctx)
+	assert.False(t, oid.ID.IsZero())
+}
+
+func TestSetDocumentID(t *testing.T) {
+	doc := &TestCounterDoc{}
+	setDocumentID(doc, int64(7))
+	assert.Equal(t, int64(7), doc.ID)
+	setDocumentID(doc, int64(8))
+	assert.Equal(t, int64(7), doc.ID)
+
+	user := &TestUser{}
+	setDocumentID(user, "not an ObjectID")
+	assert.True(t, user.ID.IsZero())
+	id := primitive.NewObjectID()
+	setDocumentID(user, id)
+	assert.Equal(t, id, user.ID)
+
+	// ObjectIDs go through SetID, which ignores them for other ID types.
+	order := &TestOrder{}
+	setDocumentID(order, id)
+	assert.Empty(t, order.ID)
+	setDocumentID(order, testOrderID("a"))
+	assert.Equal(t, testOrderID("a"), order.ID)
+}
+
+func TestRepoOf(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	RegisterIDGenerator(func() testOrderID { return testOrderID(NewUUIDv7()) })
+	orders := NewRepoOf[*TestOrder, testOrderID](db.Collection(testColl))
+
+	ctx := context.TODO()
+	order, err := orders.InsertOne(ctx, &TestOrder{Total: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, order.ID)
+
+	got, err := orders.GetOf(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), got.Total)
+
+	n, err := orders.UpdateByIDOf(ctx, order.ID, bson.M{"$set": bson.M{"total": 20}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = orders.DeleteByIDOf(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	counters := NewRepoOf[*TestCounterDoc, int64](db.Collection("test_counters"))
+	err = counters.InsertMany(ctx, []*TestCounterDoc{{DefaultFieldOf: DefaultFieldOf[int64]{ID: 1}, Name: "a"}, {DefaultFieldOf: DefaultFieldOf[int64]{ID: 2}, Name: "b"}})
+	require.NoError(t, err)
+	counter, err := counters.GetOf(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "b", counter.Name)
+
+	users := NewRepo[*TestUser](db.Collection("test_users"))
+	user, err := users.InsertOne(ctx, &TestUser{Name: "go"})
+	require.NoError(t, err)
+	n, err = users.DeleteByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -2,19 +2,38 @@ package modm
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// EnsureIndexes creates unique and non-unique indexes in the collection.
+// EnsureIndexes creates unique and non-unique indexes in the collection, together with the
+// indexes declared with modm struct tags on T (see TagIndexes). A tag index with the same keys as
+// an explicit index is skipped.
+// Existing duplicates can be checked first with WithDuplicateCheck.
+// The uniques and indexes use the syntax of ParseIndex. The ttl of an existing TTL index is updated in place.
 func (r *Repo[T]) EnsureIndexes(ctx context.Context, uniques []string, indexes []string, indexModels ...mongo.IndexModel) error {
-	indexesModel := IndexesToModel(uniques, indexes)
+	indexesModel, err := ParseIndexes(uniques, indexes)
+	if err != nil {
+		return err
+	}
 	indexesModel = append(indexesModel, indexModels...)
-	var err error
-	if len(indexesModel) > 0 {
-		_, err = r.collection.Indexes().CreateMany(ctx, indexesModel)
+	tagModels, err := TagIndexes[T]()
+	if err != nil {
+		return err
+	}
+	indexesModel, err = dedupeIndexes(append(indexesModel, tagModels...))
+	if err != nil {
+		return err
 	}
-	return err
+	return r.createIndexes(ctx, indexesModel)
 }
 
 // Indexes is an interface for defining unique and non-unique indexes.
@@ -24,13 +43,311 @@ type Indexes interface {
 	IndexModels() []mongo.IndexModel
 }
 
-// EnsureIndexesByModel creates indexes in the collection based on an Indexes interface.
+// EnsureIndexesByModel creates indexes in the collection based on an Indexes interface,
+// together with the indexes declared by the structs embedded in T (see DeclaredIndexes) and with
+// modm struct tags on T (see TagIndexes).
+// Existing duplicates can be checked first with WithDuplicateCheck.
 func (r *Repo[T]) EnsureIndexesByModel(ctx context.Context, model Indexes) error {
-	indexesModel := IndexesToModel(model.Uniques(), model.Indexes())
-	indexesModel = append(indexesModel, model.IndexModels()...)
-	var err error
-	if len(indexesModel) > 0 {
-		_, err = r.collection.Indexes().CreateMany(ctx, indexesModel)
+	indexesModel, err := declaredIndexes[T](model)
+	if err != nil {
+		return err
+	}
+	return r.createIndexes(ctx, indexesModel)
+}
+
+// createIndexes validates models (see ValidateIndex), handles their duplicates, updates the
+// ttl of the existing TTL indexes in place, and creates them.
+func (r *Repo[T]) createIndexes(ctx context.Context, models []mongo.IndexModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+	if err := validateIndexes(models); err != nil {
+		return err
+	}
+	if err := r.checkDuplicates(ctx, models); err != nil {
+		return err
+	}
+	if err := r.updateTTLs(ctx, models); err != nil {
+		return err
+	}
+	_, err := r.collection.Indexes().CreateMany(ctx, models)
+	return wrapError(err)
+}
+
+// updateTTLs changes the ttl of the existing TTL indexes of models with collMod, since creating
+// them again with another ttl fails.
+func (r *Repo[T]) updateTTLs(ctx context.Context, models []mongo.IndexModel) error {
+	var ttlModels []mongo.IndexModel
+	for _, model := range models {
+		if model.Options != nil && model.Options.ExpireAfterSeconds != nil {
+			ttlModels = append(ttlModels, model)
+		}
+	}
+	if len(ttlModels) == 0 {
+		return nil
+	}
+	existing, err := r.listIndexSpecs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, model := range ttlModels {
+		spec, err := declaredIndexSpec(model)
+		if err != nil {
+			return err
+		}
+		current := findIndexSpec(existing, map[string]bool{}, spec)
+		if current == nil || current.Options["expireAfterSeconds"] == nil ||
+			current.Options["expireAfterSeconds"] == spec.Options["expireAfterSeconds"] {
+			continue
+		}
+		ttl := bson.E{Key: "expireAfterSeconds", Value: *model.Options.ExpireAfterSeconds}
+		if err := r.modifyIndex(ctx, current.Name, bson.D{ttl}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declaredIndexes returns the indexes declared by model, by the structs embedded in T that
+// implement Indexes, and with modm struct tags on T, deduplicated by key spec. Earlier
+// declarations win, so that model overrides the indexes of the mixins.
+func declaredIndexes[T Document](model Indexes) ([]mongo.IndexModel, error) {
+	var sources []Indexes
+	if model != nil {
+		sources = append(sources, model)
+	}
+	sources = append(sources, mixinIndexes(reflect.TypeOf((*T)(nil)).Elem(), map[reflect.Type]bool{})...)
+	var models []mongo.IndexModel
+	for _, source := range sources {
+		parsed, err := ParseIndexes(source.Uniques(), source.Indexes())
+		if err != nil {
+			return nil, err
+		}
+		models = append(append(models, parsed...), source.IndexModels()...)
+	}
+	tagModels, err := TagIndexes[T]()
+	if err != nil {
+		return nil, err
+	}
+	return dedupeIndexes(append(models, tagModels...))
+}
+
+// mixinIndexes returns the zero values of the structs embedded in t, recursively, that implement Indexes.
+func mixinIndexes(t reflect.Type, seen map[reflect.Type]bool) []Indexes {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var mixins []Indexes
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := indirectType(sf.Type)
+		if !sf.Anonymous || ft.Kind() != reflect.Struct || seen[ft] {
+			continue
+		}
+		seen[ft] = true
+		if mixin, ok := reflect.New(ft).Interface().(Indexes); ok {
+			mixins = append(mixins, mixin)
+		}
+		mixins = append(mixins, mixinIndexes(ft, seen)...)
+	}
+	return mixins
+}
+
+// dedupeIndexes removes the indexes whose keys, partial filter and collation are the same as those
+// of an earlier index. Indexes on the same keys that differ in partial filter or collation can
+// coexist, so they are kept.
+func dedupeIndexes(models []mongo.IndexModel) ([]mongo.IndexModel, error) {
+	seen := map[string]bool{}
+	var unique []mongo.IndexModel
+	for _, model := range models {
+		spec, err := declaredIndexSpec(model)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprint(orderedIndexKeys(spec.Keys), spec.Options["partialFilterExpression"], spec.Options["collation"])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, model)
+	}
+	return unique, nil
+}
+
+// tagIndex is an index declared with modm struct tags.
+type tagIndex struct {
+	name    string
+	keys    bson.D
+	unique  bool
+	sparse  bool
+	ttl     *int32
+	weights bson.D
+}
+
+// TagIndexes returns the indexes declared with modm struct tags on the fields of T, including
+// the fields of inlined mixins and nested documents:
+//
+//	`modm:"index"`           ascending index on the field
+//	`modm:"index=-1"`        descending index on the field
+//	`modm:"unique"`          unique index on the field
+//	`modm:"index=name_age"`  field of the compound index named name_age, in field order;
+//	                         `modm:"index=name_age,-1"` for a descending key, and
+//	                         `modm:"unique=name_age"` for a unique compound index
+//	`modm:"ttl=720h"`        TTL index (a duration or a number of seconds)
+//	`modm:"text"`            field of the text index of the collection; `modm:"text=5"` sets its weight
+//	`modm:"2dsphere"`        2dsphere index on the field
+//	`modm:"sparse"`          makes the indexes of the field sparse
+func TagIndexes[T Document]() ([]mongo.IndexModel, error) {
+	return tagIndexModels(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func tagIndexModels(t reflect.Type) ([]mongo.IndexModel, error) {
+	var list []*tagIndex
+	groups := map[string]*tagIndex{}
+	var text *tagIndex
+	err := collectTagIndexes(indirectType(t), "", map[reflect.Type]bool{}, func(path string, tag modmTag) error {
+		var own []*tagIndex
+		for _, opt := range tag {
+			switch opt.Key {
+			case "index", "unique":
+				group, dir, err := parseIndexTagValue(opt.Value)
+				if err != nil {
+					return fmt.Errorf("modm: field %s: %v", path, err)
+				}
+				idx := groups[group]
+				if idx == nil || group == "" {
+					idx = &tagIndex{name: group}
+					list = append(list, idx)
+					if group != "" {
+						groups[group] = idx
+					}
+				}
+				idx.keys = append(idx.keys, bson.E{Key: path, Value: dir})
+				idx.unique = idx.unique || opt.Key == "unique"
+				own = append(own, idx)
+			case "ttl":
+				seconds, err := parseTTL(opt.Value)
+				if err != nil {
+					return fmt.Errorf("modm: field %s: %v", path, err)
+				}
+				idx := &tagIndex{keys: bson.D{{Key: path, Value: int32(1)}}, ttl: &seconds}
+				list = append(list, idx)
+				own = append(own, idx)
+			case "text":
+				if text == nil {
+					text = &tagIndex{}
+					list = append(list, text)
+				}
+				text.keys = append(text.keys, bson.E{Key: path, Value: "text"})
+				if opt.Value != "" {
+					weight, err := strconv.Atoi(opt.Value)
+					if err != nil || weight < 1 {
+						return fmt.Errorf("modm: field %s: invalid text weight %q", path, opt.Value)
+					}
+					text.weights = append(text.weights, bson.E{Key: path, Value: int32(weight)})
+				}
+				own = append(own, text)
+			case "2dsphere":
+				idx := &tagIndex{keys: bson.D{{Key: path, Value: "2dsphere"}}}
+				list = append(list, idx)
+				own = append(own, idx)
+			}
+		}
+		if tag.Has("sparse") {
+			if len(own) == 0 {
+				return fmt.Errorf("modm: field %s: sparse without an index", path)
+			}
+			for _, idx := range own {
+				idx.sparse = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]mongo.IndexModel, 0, len(list))
+	for _, idx := range list {
+		opts := options.Index()
+		if idx.name != "" {
+			opts.SetName(idx.name)
+		}
+		if idx.unique {
+			opts.SetUnique(true)
+		}
+		if idx.sparse {
+			opts.SetSparse(true)
+		}
+		if idx.ttl != nil {
+			opts.SetExpireAfterSeconds(*idx.ttl)
+		}
+		if len(idx.weights) > 0 {
+			opts.SetWeights(idx.weights)
+		}
+		models = append(models, mongo.IndexModel{Keys: idx.keys, Options: opts})
+	}
+	return models, nil
+}
+
+// collectTagIndexes calls fn for each field of t with a modm tag, with its bson path.
+// Nested documents and arrays of documents are traversed; seen guards against recursive types.
+func collectTagIndexes(t reflect.Type, prefix string, seen map[reflect.Type]bool, fn func(path string, tag modmTag) error) error {
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	for _, field := range getStructInfo(t).Fields {
+		path := prefix + field.Name
+		if len(field.Modm) > 0 {
+			if err := fn(path, field.Modm); err != nil {
+				return err
+			}
+		}
+		ft := indirectType(field.Type)
+		for isArrayType(ft) {
+			ft = indirectType(ft.Elem())
+		}
+		if ft.Kind() == reflect.Struct && !isAtomicStruct(ft) {
+			if err := collectTagIndexes(ft, path+".", seen, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseIndexTagValue parses the value of an index or unique tag option: [name][,direction].
+func parseIndexTagValue(value string) (string, int32, error) {
+	if value == "" {
+		return "", 1, nil
+	}
+	parts := strings.Split(value, ",")
+	name, dir := parts[0], "1"
+	if _, err := strconv.Atoi(name); err == nil {
+		name, dir = "", parts[0]
+	} else if len(parts) > 1 {
+		dir = parts[1]
+	}
+	if len(parts) > 2 || dir != "1" && dir != "-1" {
+		return "", 0, fmt.Errorf("invalid index %q", value)
+	}
+	if dir == "-1" {
+		return name, -1, nil
+	}
+	return name, 1, nil
+}
+
+// parseTTL parses the value of a ttl tag option, a duration ("720h") or a number of seconds.
+func parseTTL(value string) (int32, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 32); err == nil && seconds >= 0 {
+		return int32(seconds), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || d.Seconds() > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid ttl %q", value)
 	}
-	return err
+	return int32(d.Seconds()), nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -165,3 +166,210 @@ func TestRepo_EnsureIndexesByModel(t *testing.T) {
 		})
 	}
 }
+
+type TestIndexedAddress struct {
+	City     string    `bson:"city" modm:"index"`
+	Location []float64 `bson:"location" modm:"2dsphere,sparse"`
+}
+
+type TestIndexedUser struct {
+	DefaultField `bson:",inline"`
+	Email        string                `bson:"email" modm:"unique,sparse"`
+	Name         string                `bson:"name" modm:"index=name_age,text=10"`
+	Age          uint                  `bson:"age" modm:"index=name_age,-1"`
+	Bio          string                `bson:"bio" modm:"text"`
+	Code         string                `bson:"code" modm:"unique=tenant_code"`
+	Tenant       string                `bson:"tenant" modm:"unique=tenant_code"`
+	Score        int                   `bson:"score" modm:"index=-1"`
+	ExpiresAt    time.Time             `bson:"expires_at" modm:"ttl=720h"`
+	Addresses    []*TestIndexedAddress `bson:"addresses"`
+}
+
+func TestTagIndexes(t *testing.T) {
+	models, err := TagIndexes[*TestIndexedUser]()
+	require.NoError(t, err)
+	require.Len(t, models, 8)
+
+	type index struct {
+		Keys    bson.D
+		Name    *string
+		Unique  *bool
+		Sparse  *bool
+		TTL     *int32
+		Weights interface{}
+	}
+	got := make([]index, len(models))
+	for i, m := range models {
+		got[i] = index{Keys: m.Keys.(bson.D), Name: m.Options.Name, Unique: m.Options.Unique, Sparse: m.Options.Sparse, TTL: m.Options.ExpireAfterSeconds, Weights: m.Options.Weights}
+	}
+	ttl := int32(720 * 3600)
+	assert.Equal(t, []index{
+		{Keys: bson.D{{Key: "email", Value: int32(1)}}, Unique: GetPointer(true), Sparse: GetPointer(true)},
+		{Keys: bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, Name: GetPointer("name_age")},
+		{Keys: bson.D{{Key: "name", Value: "text"}, {Key: "bio", Value: "text"}}, Weights: bson.D{{Key: "name", Value: int32(10)}}},
+		{Keys: bson.D{{Key: "code", Value: int32(1)}, {Key: "tenant", Value: int32(1)}}, Name: GetPointer("tenant_code"), Unique: GetPointer(true)},
+		{Keys: bson.D{{Key: "score", Value: int32(-1)}}},
+		{Keys: bson.D{{Key: "expires_at", Value: int32(1)}}, TTL: &ttl},
+		{Keys: bson.D{{Key: "addresses.city", Value: int32(1)}}},
+		{Keys: bson.D{{Key: "addresses.location", Value: "2dsphere"}}, Sparse: GetPointer(true)},
+	}, got)
+
+	type badTTL struct {
+		DefaultField `bson:",inline"`
+		At           time.Time `bson:"at" modm:"ttl=soon"`
+	}
+	_, err = TagIndexes[*badTTL]()
+	assert.Error(t, err)
+	type badIndex struct {
+		DefaultField `bson:",inline"`
+		A            int `bson:"a" modm:"index=x,2"`
+	}
+	_, err = TagIndexes[*badIndex]()
+	assert.Error(t, err)
+	type badSparse struct {
+		DefaultField `bson:",inline"`
+		A            int `bson:"a" modm:"sparse"`
+	}
+	_, err = TagIndexes[*badSparse]()
+	assert.Error(t, err)
+}
+
+func TestRepo_EnsureIndexes_tags(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestIndexedUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	// The explicit email index replaces the one of the tag.
+	email := mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true).SetName("email_unique")}
+	require.NoError(t, repo.EnsureIndexes(ctx, []string{"uid"}, nil, email))
+	iv := repo.Collection().Indexes()
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "uid", Value: int32(1)}}, Name: "uid_1", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "email", Value: int32(1)}}, Name: "email_unique", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, Name: "name_age"})
+	verifyIndexExists(t, iv, testIndex{Name: "name_text_bio_text"})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "code", Value: int32(1)}, {Key: "tenant", Value: int32(1)}}, Name: "tenant_code", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "expires_at", Value: int32(1)}}, Name: "expires_at_1"})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "addresses.location", Value: "2dsphere"}}, Name: "addresses.location_2dsphere"})
+}
+
+func TestRepo_EnsureIndexes_spec(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.EnsureIndexes(ctx, []string{"name:sparse;partial={age:{$gt:1}};name=adult_name"}, []string{"bio@text;language=english"})
+	require.NoError(t, err)
+	iv := repo.Collection().Indexes()
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "name", Value: int32(1)}}, Name: "adult_name", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Name: "bio_text"})
+
+	err = repo.EnsureIndexes(ctx, nil, []string{"name;partial={age:}"})
+	var syntaxErr *IndexSyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+}
+
+type TestTenantMixin struct {
+	Tenant string `bson:"tenant"`
+}
+
+func (m *TestTenantMixin) Uniques() []string {
+	return []string{}
+}
+
+func (m *TestTenantMixin) Indexes() []string {
+	return []string{"tenant", "tenant,-created_at"}
+}
+
+func (m *TestTenantMixin) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{}
+}
+
+type TestAuditMixin struct {
+	AuditID string `bson:"audit_id"`
+}
+
+func (m *TestAuditMixin) Uniques() []string {
+	return []string{"audit_id"}
+}
+
+func (m *TestAuditMixin) Indexes() []string {
+	return []string{}
+}
+
+func (m *TestAuditMixin) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{{Keys: bson.D{{Key: "tenant", Value: 1}}}}
+}
+
+type TestTenantUser struct {
+	DefaultField    `bson:",inline"`
+	TestTenantMixin `bson:",inline"`
+	*TestAuditMixin `bson:",inline"`
+	Name            string `bson:"name" modm:"index"`
+}
+
+func (u *TestTenantUser) Uniques() []string {
+	return []string{"tenant,-created_at"}
+}
+
+func (u *TestTenantUser) Indexes() []string {
+	return []string{}
+}
+
+func (u *TestTenantUser) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{}
+}
+
+func TestDeclaredIndexes_mixins(t *testing.T) {
+	models, err := DeclaredIndexes[*TestTenantUser]()
+	require.NoError(t, err)
+
+	type index struct {
+		Keys   bson.D
+		Unique bool
+	}
+	got := make([]index, len(models))
+	for i, m := range models {
+		got[i] = index{Keys: m.Keys.(bson.D), Unique: isUniqueIndex(m)}
+	}
+	assert.Equal(t, []index{
+		{Keys: bson.D{{Key: "tenant", Value: int32(1)}, {Key: "created_at", Value: int32(-1)}}, Unique: true},
+		{Keys: bson.D{{Key: "tenant", Value: int32(1)}}},
+		{Keys: bson.D{{Key: "audit_id", Value: int32(1)}}, Unique: true},
+		{Keys: bson.D{{Key: "name", Value: int32(1)}}},
+	}, got)
+}
+
+func TestRepo_EnsureIndexesByModel_mixins(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestTenantUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	require.NoError(t, repo.EnsureIndexesByModel(ctx, &TestTenantUser{}))
+	iv := repo.Collection().Indexes()
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "tenant", Value: int32(1)}, {Key: "created_at", Value: int32(-1)}}, Name: "tenant_1_created_at_-1", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "tenant", Value: int32(1)}}, Name: "tenant_1"})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "audit_id", Value: int32(1)}}, Name: "audit_id_1", Unique: true})
+	verifyIndexExists(t, iv, testIndex{Key: bson.D{{Key: "name", Value: int32(1)}}, Name: "name_1"})
+}
+
+func TestDedupeIndexes(t *testing.T) {
+	live := bson.M{"deleted_at": nil}
+	ci := &options.Collation{Locale: "en", Strength: 2}
+	models, err := dedupeIndexes([]mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: int32(1)}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetPartialFilterExpression(live)},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetPartialFilterExpression(live).SetSparse(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetCollation(ci)},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "name", Value: 1}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, models, 5)
+	assert.True(t, *models[0].Options.Unique)
+	assert.Equal(t, live, models[1].Options.PartialFilterExpression)
+	assert.Equal(t, ci, models[2].Options.Collation)
+}
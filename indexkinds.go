@@ -0,0 +1,182 @@
+package modm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TTLIndex returns an index on field that expires the documents ttl after the time stored in
+// the field. The field must hold a date, or an array of dates. Changing the ttl of an existing
+// index with EnsureIndexes or SyncIndexes updates it in place.
+func TTLIndex(field string, ttl time.Duration) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: int32(1)}},
+		Options: options.Index().SetExpireAfterSeconds(int32(ttl / time.Second)),
+	}
+}
+
+// TextIndex returns a text index over fields. The weights can be set with Options.SetWeights.
+// A collection has at most one text index.
+func TextIndex(fields ...string) mongo.IndexModel {
+	keys := make(bson.D, len(fields))
+	for i, field := range fields {
+		keys[i] = bson.E{Key: field, Value: "text"}
+	}
+	return mongo.IndexModel{Keys: keys, Options: options.Index()}
+}
+
+// Geo2DSphereIndex returns a 2dsphere index on field, which holds GeoJSON objects or legacy
+// coordinate pairs.
+func Geo2DSphereIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: "2dsphere"}},
+		Options: options.Index(),
+	}
+}
+
+// WildcardIndex returns a wildcard index on all the fields below path, e.g. the keys of a
+// free-form attribute map, or on all the fields of the documents if path is empty. In the latter
+// case, projection selects the fields to index, or to exclude when prefixed with "-".
+func WildcardIndex(path string, projection ...string) mongo.IndexModel {
+	key := "$**"
+	if path != "" {
+		key = path + ".$**"
+	}
+	opts := options.Index()
+	if len(projection) > 0 {
+		proj := bson.D{}
+		for _, field := range projection {
+			field, dir := SplitSortField(field)
+			if dir < 0 {
+				proj = append(proj, bson.E{Key: field, Value: int32(0)})
+			} else {
+				proj = append(proj, bson.E{Key: field, Value: int32(1)})
+			}
+		}
+		opts.SetWildcardProjection(proj)
+	}
+	return mongo.IndexModel{Keys: bson.D{{Key: key, Value: int32(1)}}, Options: opts}
+}
+
+// ValidateIndex reports the errors of an index model that the server would reject or ignore:
+// unknown key types, TTL on compound or _id indexes, invalid text weights, and wildcard or
+// hashed indexes with unsupported options.
+func ValidateIndex(model mongo.IndexModel) error {
+	keys, err := toBsonD(model.Keys)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("modm: index has no keys")
+	}
+	name := indexName(model)
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("modm: index %s: %s", name, fmt.Sprintf(format, args...))
+	}
+	o := model.Options
+	if o == nil {
+		o = options.Index()
+	}
+	unique := o.Unique != nil && *o.Unique
+	var text, wildcard, hashed int
+	for _, k := range keys {
+		if strings.HasSuffix(k.Key, "$**") {
+			wildcard++
+		}
+		switch v := k.Value.(type) {
+		case string:
+			switch v {
+			case "text":
+				text++
+			case "hashed":
+				hashed++
+			case "2dsphere", "2d":
+			default:
+				return invalid("unknown index type %q for %s", v, k.Key)
+			}
+		case int, int32, int64, float64:
+			if normalizeIndexValue(v) == float64(0) {
+				return invalid("key %s has direction 0", k.Key)
+			}
+		default:
+			return invalid("invalid key %s: %v", k.Key, k.Value)
+		}
+	}
+
+	if o.ExpireAfterSeconds != nil {
+		switch {
+		case *o.ExpireAfterSeconds < 0:
+			return invalid("negative ttl")
+		case len(keys) > 1:
+			return invalid("ttl requires a single-field index")
+		case keys[0].Key == "_id":
+			return invalid("ttl is not supported on _id")
+		case wildcard > 0:
+			return invalid("ttl is not supported on wildcard indexes")
+		}
+	}
+	if o.Weights != nil {
+		weights, err := toBsonD(o.Weights)
+		if err != nil {
+			return err
+		}
+		if len(weights) > 0 && text == 0 {
+			return invalid("weights require a text index")
+		}
+		for _, w := range weights {
+			weight, ok := normalizeIndexValue(w.Value).(float64)
+			if !ok || weight < 1 || weight > math.MaxInt32 {
+				return invalid("invalid weight %v for %s", w.Value, w.Key)
+			}
+		}
+	}
+	if wildcard > 0 {
+		switch {
+		case wildcard > 1:
+			return invalid("more than one wildcard key")
+		case unique:
+			return invalid("wildcard indexes cannot be unique")
+		case o.Sparse != nil && *o.Sparse:
+			return invalid("wildcard indexes cannot be sparse")
+		}
+	}
+	if o.WildcardProjection != nil && (len(keys) != 1 || keys[0].Key != "$**") {
+		return invalid(`wildcard projection requires a "$**" key`)
+	}
+	if hashed > 1 {
+		return invalid("more than one hashed key")
+	}
+	if hashed > 0 && unique {
+		return invalid("hashed indexes cannot be unique")
+	}
+	return nil
+}
+
+// validateIndexes validates models (see ValidateIndex) and checks that they declare at most one text index.
+func validateIndexes(models []mongo.IndexModel) error {
+	var textIndex string
+	for _, model := range models {
+		if err := ValidateIndex(model); err != nil {
+			return err
+		}
+		keys, _ := toBsonD(model.Keys)
+		for _, k := range keys {
+			if k.Value != "text" {
+				continue
+			}
+			name := indexName(model)
+			if textIndex != "" && textIndex != name {
+				return fmt.Errorf("modm: more than one text index: %s and %s", textIndex, name)
+			}
+			textIndex = name
+			break
+		}
+	}
+	return nil
+}
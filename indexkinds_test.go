@@ -0,0 +1,87 @@
+package modm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIndexConstructors(t *testing.T) {
+	ttl := TTLIndex("expires_at", 2*time.Hour)
+	assert.Equal(t, bson.D{{Key: "expires_at", Value: int32(1)}}, ttl.Keys)
+	assert.Equal(t, int32(7200), *ttl.Options.ExpireAfterSeconds)
+
+	text := TextIndex("title", "body")
+	assert.Equal(t, bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}, text.Keys)
+
+	geo := Geo2DSphereIndex("location")
+	assert.Equal(t, bson.D{{Key: "location", Value: "2dsphere"}}, geo.Keys)
+
+	wildcard := WildcardIndex("attributes")
+	assert.Equal(t, bson.D{{Key: "attributes.$**", Value: int32(1)}}, wildcard.Keys)
+	assert.Nil(t, wildcard.Options.WildcardProjection)
+
+	wildcard = WildcardIndex("", "-secret", "-password")
+	assert.Equal(t, bson.D{{Key: "$**", Value: int32(1)}}, wildcard.Keys)
+	assert.Equal(t, bson.D{{Key: "secret", Value: int32(0)}, {Key: "password", Value: int32(0)}}, wildcard.Options.WildcardProjection)
+
+	for _, model := range []mongo.IndexModel{ttl, text, geo, wildcard} {
+		assert.NoError(t, ValidateIndex(model))
+	}
+}
+
+func TestValidateIndex(t *testing.T) {
+	keys := func(fields ...bson.E) bson.D { return fields }
+	tests := []struct {
+		model mongo.IndexModel
+		err   string
+	}{
+		{mongo.IndexModel{Keys: bson.D{}}, "modm: index has no keys"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: "btree"})}, `modm: index a_btree: unknown index type "btree" for a`},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: 0})}, "modm: index a_0: key a has direction 0"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: 1}, bson.E{Key: "b", Value: 1}), Options: options.Index().SetExpireAfterSeconds(60)}, "modm: index a_1_b_1: ttl requires a single-field index"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "_id", Value: 1}), Options: options.Index().SetExpireAfterSeconds(60)}, "modm: index _id_1: ttl is not supported on _id"},
+		{TTLIndex("a", -time.Second), "modm: index a_1: negative ttl"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: 1}), Options: options.Index().SetWeights(bson.D{{Key: "a", Value: 2}})}, "modm: index a_1: weights require a text index"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: "text"}), Options: options.Index().SetWeights(bson.D{{Key: "a", Value: 0}})}, "modm: index a_text: invalid weight 0 for a"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a.$**", Value: 1}), Options: options.Index().SetUnique(true)}, "modm: index a.$**_1: wildcard indexes cannot be unique"},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a.$**", Value: 1}), Options: options.Index().SetWildcardProjection(bson.D{{Key: "b", Value: 1}})}, `modm: index a.$**_1: wildcard projection requires a "$**" key`},
+		{mongo.IndexModel{Keys: keys(bson.E{Key: "a", Value: "hashed"}), Options: options.Index().SetUnique(true)}, "modm: index a_hashed: hashed indexes cannot be unique"},
+	}
+	for _, tt := range tests {
+		err := ValidateIndex(tt.model)
+		if assert.Error(t, err) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+
+	err := validateIndexes([]mongo.IndexModel{TextIndex("title"), TextIndex("body")})
+	assert.EqualError(t, err, "modm: more than one text index: title_text and body_text")
+	assert.NoError(t, validateIndexes([]mongo.IndexModel{TextIndex("title"), TTLIndex("expires_at", time.Hour)}))
+}
+
+func TestRepo_EnsureIndexes_ttl(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	require.NoError(t, repo.EnsureIndexes(ctx, nil, nil, TTLIndex("expires_at", time.Hour)))
+	require.NoError(t, repo.EnsureIndexes(ctx, nil, nil, TTLIndex("expires_at", 2*time.Hour)))
+
+	specs, err := repo.listIndexSpecs(ctx)
+	require.NoError(t, err)
+	var ttl interface{}
+	for _, spec := range specs {
+		if spec.Name == "expires_at_1" {
+			ttl = spec.Options["expireAfterSeconds"]
+		}
+	}
+	assert.Equal(t, float64(7200), ttl)
+}
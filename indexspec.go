@@ -0,0 +1,480 @@
+package modm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSyntaxError is returned by ParseIndex for an invalid index specification.
+type IndexSyntaxError struct {
+	Spec string
+	// Pos is the byte offset of the error in Spec.
+	Pos int
+	Msg string
+}
+
+func (e *IndexSyntaxError) Error() string {
+	return fmt.Sprintf("modm: invalid index %q at position %d: %s", e.Spec, e.Pos, e.Msg)
+}
+
+// ParseIndex parses an index specification:
+//
+//	keys[:flags][;option=value...]
+//
+// keys is a comma-separated list of fields, each prefixed with "-" for a descending key or
+// suffixed with "@text", "@2dsphere", "@2d" or "@hashed" for special indexes; "$**" and
+// "field.$**" are wildcard keys. Fields cannot contain spaces or any of {}[]:;=@+. flags is a comma-separated list of unique, sparse and hidden.
+// The options are:
+//
+//	name=<name>           index name
+//	ttl=<duration>        expiration, e.g. 720h or a number of seconds
+//	partial={...}         partial filter expression
+//	collation={...}       collation, e.g. {locale:"en",strength:2}
+//	weights={...}         text weights, e.g. {title:10,body:2}
+//	language=<language>   default language of a text index
+//	projection={...}      wildcard projection
+//
+// Documents are written in a relaxed JSON syntax with optional quotes around keys:
+//
+//	"email:unique,sparse;partial={deleted_at:null}"
+//	"title@text,body@text;weights={title:10};name=search"
+func ParseIndex(spec string) (mongo.IndexModel, error) {
+	p := &indexParser{spec: spec}
+	return p.parse()
+}
+
+// ParseIndexes parses index specifications (see ParseIndex). The indexes of uniques are unique.
+func ParseIndexes(uniques []string, indexes []string) ([]mongo.IndexModel, error) {
+	var models []mongo.IndexModel
+	for _, spec := range uniques {
+		model, err := ParseIndex(spec)
+		if err != nil {
+			return nil, err
+		}
+		if model.Options == nil {
+			model.Options = options.Index()
+		}
+		model.Options.SetUnique(true)
+		models = append(models, model)
+	}
+	for _, spec := range indexes {
+		model, err := ParseIndex(spec)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+type indexParser struct {
+	spec string
+	pos  int
+}
+
+func (p *indexParser) errorf(pos int, format string, args ...interface{}) error {
+	return &IndexSyntaxError{Spec: p.spec, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *indexParser) parse() (mongo.IndexModel, error) {
+	var model mongo.IndexModel
+	sections := splitTopLevel(p.spec, 0, ';')
+	head := sections[0]
+	keysPart, flagsPart, hasFlags := head, section{}, false
+	if i := strings.IndexByte(head.text, ':'); i >= 0 {
+		keysPart = section{text: head.text[:i], pos: head.pos}
+		flagsPart, hasFlags = section{text: head.text[i+1:], pos: head.pos + i + 1}, true
+	}
+
+	keys := bson.D{}
+	hasText, hasWildcard := false, false
+	for _, key := range splitTopLevel(keysPart.text, keysPart.pos, ',') {
+		field, value, err := p.parseKey(key)
+		if err != nil {
+			return model, err
+		}
+		for _, e := range keys {
+			if e.Key == field {
+				return model, p.errorf(key.pos, "duplicate key %q", field)
+			}
+		}
+		hasText = hasText || value == "text"
+		hasWildcard = hasWildcard || strings.HasSuffix(field, "$**")
+		keys = append(keys, bson.E{Key: field, Value: value})
+	}
+	model.Keys = keys
+
+	var opts *options.IndexOptions
+	indexOptions := func() *options.IndexOptions {
+		if opts == nil {
+			opts = options.Index()
+		}
+		return opts
+	}
+	if hasFlags {
+		for _, flag := range splitTopLevel(flagsPart.text, flagsPart.pos, ',') {
+			switch strings.TrimSpace(flag.text) {
+			case "unique":
+				indexOptions().SetUnique(true)
+			case "sparse":
+				indexOptions().SetSparse(true)
+			case "hidden":
+				indexOptions().SetHidden(true)
+			case "":
+				return model, p.errorf(flag.pos, "empty flag")
+			default:
+				return model, p.errorf(flag.pos, "unknown flag %q", strings.TrimSpace(flag.text))
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, opt := range sections[1:] {
+		i := strings.IndexByte(opt.text, '=')
+		if i < 0 {
+			return model, p.errorf(opt.pos, "expected option=value")
+		}
+		name := strings.TrimSpace(opt.text[:i])
+		value := section{text: opt.text[i+1:], pos: opt.pos + i + 1}
+		if seen[name] {
+			return model, p.errorf(opt.pos, "duplicate option %q", name)
+		}
+		seen[name] = true
+		switch name {
+		case "name":
+			if strings.TrimSpace(value.text) == "" {
+				return model, p.errorf(value.pos, "empty name")
+			}
+			indexOptions().SetName(strings.TrimSpace(value.text))
+		case "ttl":
+			seconds, err := parseTTL(strings.TrimSpace(value.text))
+			if err != nil {
+				return model, p.errorf(value.pos, "%v", err)
+			}
+			indexOptions().SetExpireAfterSeconds(seconds)
+		case "language":
+			if !hasText {
+				return model, p.errorf(opt.pos, "language requires a text key")
+			}
+			indexOptions().SetDefaultLanguage(strings.TrimSpace(value.text))
+		case "partial", "collation", "weights", "projection":
+			doc, err := p.parseDocument(value)
+			if err != nil {
+				return model, err
+			}
+			switch name {
+			case "partial":
+				indexOptions().SetPartialFilterExpression(doc)
+			case "collation":
+				collation, err := p.collation(doc, value.pos)
+				if err != nil {
+					return model, err
+				}
+				indexOptions().SetCollation(collation)
+			case "weights":
+				if !hasText {
+					return model, p.errorf(opt.pos, "weights requires a text key")
+				}
+				indexOptions().SetWeights(doc)
+			case "projection":
+				if !hasWildcard {
+					return model, p.errorf(opt.pos, "projection requires a wildcard key")
+				}
+				indexOptions().SetWildcardProjection(doc)
+			}
+		default:
+			return model, p.errorf(opt.pos, "unknown option %q", name)
+		}
+	}
+	model.Options = opts
+	return model, nil
+}
+
+// parseKey parses a key of the specification: [+|-]field[@type].
+func (p *indexParser) parseKey(key section) (string, interface{}, error) {
+	text := strings.TrimSpace(key.text)
+	pos := key.pos + strings.Index(key.text, text)
+	if text == "" {
+		return "", nil, p.errorf(key.pos, "empty key")
+	}
+	field, kind := text, ""
+	if i := strings.IndexByte(text, '@'); i >= 0 {
+		field, kind = text[:i], text[i+1:]
+	}
+	field, dir := SplitSortField(field)
+	if field == "" {
+		return "", nil, p.errorf(pos, "empty field")
+	}
+	if strings.ContainsAny(field, " {}[]:;=@+") || strings.HasPrefix(field, "-") {
+		return "", nil, p.errorf(pos, "invalid field %q", field)
+	}
+	if strings.Contains(field, "$**") && field != "$**" && !strings.HasSuffix(field, ".$**") {
+		return "", nil, p.errorf(pos, "invalid wildcard field %q", field)
+	}
+	switch kind {
+	case "":
+		return field, dir, nil
+	case "text", "2dsphere", "2d", "hashed":
+		if text[0] == '-' || text[0] == '+' {
+			return "", nil, p.errorf(pos, "%s key cannot have a direction", kind)
+		}
+		return field, kind, nil
+	}
+	return "", nil, p.errorf(pos+strings.IndexByte(text, '@')+1, "unknown index type %q", kind)
+}
+
+func (p *indexParser) parseDocument(s section) (bson.D, error) {
+	r := &relaxedReader{p: p, s: p.spec[:s.pos+len(s.text)], pos: s.pos}
+	r.skipSpace()
+	doc, err := r.document()
+	if err != nil {
+		return nil, err
+	}
+	r.skipSpace()
+	if r.pos < len(r.s) {
+		return nil, p.errorf(r.pos, "unexpected %q after document", r.s[r.pos])
+	}
+	return doc, nil
+}
+
+// collation converts a collation document to options.Collation.
+func (p *indexParser) collation(doc bson.D, pos int) (*options.Collation, error) {
+	c := &options.Collation{}
+	for _, e := range doc {
+		var ok bool
+		switch e.Key {
+		case "locale":
+			c.Locale, ok = e.Value.(string)
+		case "caseLevel":
+			c.CaseLevel, ok = e.Value.(bool)
+		case "caseFirst":
+			c.CaseFirst, ok = e.Value.(string)
+		case "strength":
+			var n int64
+			n, ok = e.Value.(int64)
+			c.Strength = int(n)
+		case "numericOrdering":
+			c.NumericOrdering, ok = e.Value.(bool)
+		case "alternate":
+			c.Alternate, ok = e.Value.(string)
+		case "maxVariable":
+			c.MaxVariable, ok = e.Value.(string)
+		case "normalization":
+			c.Normalization, ok = e.Value.(bool)
+		case "backwards":
+			c.Backwards, ok = e.Value.(bool)
+		default:
+			return nil, p.errorf(pos, "unknown collation field %q", e.Key)
+		}
+		if !ok {
+			return nil, p.errorf(pos, "invalid collation %s %v", e.Key, e.Value)
+		}
+	}
+	if c.Locale == "" {
+		return nil, p.errorf(pos, "collation requires a locale")
+	}
+	return c, nil
+}
+
+// section is a part of the specification with its offset.
+type section struct {
+	text string
+	pos  int
+}
+
+// splitTopLevel splits s on sep outside of documents, arrays and strings.
+func splitTopLevel(s string, offset int, sep byte) []section {
+	var parts []section
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, section{text: s[start:i], pos: offset + start})
+			start = i + 1
+		}
+	}
+	return append(parts, section{text: s[start:], pos: offset + start})
+}
+
+// relaxedReader reads documents in a relaxed JSON syntax: keys may be unquoted, strings may
+// use single quotes, and numbers without a fraction are int64.
+type relaxedReader struct {
+	p   *indexParser
+	s   string
+	pos int
+}
+
+func (r *relaxedReader) skipSpace() {
+	for r.pos < len(r.s) && (r.s[r.pos] == ' ' || r.s[r.pos] == '\t') {
+		r.pos++
+	}
+}
+
+func (r *relaxedReader) expect(c byte) error {
+	r.skipSpace()
+	if r.pos >= len(r.s) {
+		return r.p.errorf(r.pos, "expected %q, got end of input", c)
+	}
+	if r.s[r.pos] != c {
+		return r.p.errorf(r.pos, "expected %q, got %q", c, r.s[r.pos])
+	}
+	r.pos++
+	return nil
+}
+
+func (r *relaxedReader) document() (bson.D, error) {
+	if err := r.expect('{'); err != nil {
+		return nil, err
+	}
+	doc := bson.D{}
+	r.skipSpace()
+	if r.pos < len(r.s) && r.s[r.pos] == '}' {
+		r.pos++
+		return doc, nil
+	}
+	for {
+		r.skipSpace()
+		key, err := r.key()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.expect(':'); err != nil {
+			return nil, err
+		}
+		value, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: key, Value: value})
+		r.skipSpace()
+		if r.pos < len(r.s) && r.s[r.pos] == ',' {
+			r.pos++
+			continue
+		}
+		if err := r.expect('}'); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+}
+
+func (r *relaxedReader) key() (string, error) {
+	if r.pos < len(r.s) && (r.s[r.pos] == '"' || r.s[r.pos] == '\'') {
+		return r.string()
+	}
+	start := r.pos
+	for r.pos < len(r.s) && isKeyChar(r.s[r.pos]) {
+		r.pos++
+	}
+	if r.pos == start {
+		if r.pos >= len(r.s) {
+			return "", r.p.errorf(r.pos, "expected key, got end of input")
+		}
+		return "", r.p.errorf(r.pos, "expected key, got %q", r.s[r.pos])
+	}
+	return r.s[start:r.pos], nil
+}
+
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c == '.' || c == '-'
+}
+
+func (r *relaxedReader) string() (string, error) {
+	quote, start := r.s[r.pos], r.pos
+	var b strings.Builder
+	for r.pos++; r.pos < len(r.s); r.pos++ {
+		c := r.s[r.pos]
+		switch {
+		case c == '\\' && r.pos+1 < len(r.s):
+			r.pos++
+			b.WriteByte(r.s[r.pos])
+		case c == quote:
+			r.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", r.p.errorf(start, "unterminated string")
+}
+
+func (r *relaxedReader) value() (interface{}, error) {
+	r.skipSpace()
+	if r.pos >= len(r.s) {
+		return nil, r.p.errorf(r.pos, "expected value, got end of input")
+	}
+	switch c := r.s[r.pos]; {
+	case c == '{':
+		return r.document()
+	case c == '[':
+		return r.array()
+	case c == '"' || c == '\'':
+		return r.string()
+	}
+	start := r.pos
+	for r.pos < len(r.s) && isKeyChar(r.s[r.pos]) || r.pos < len(r.s) && r.s[r.pos] == '+' {
+		r.pos++
+	}
+	word := r.s[start:r.pos]
+	switch word {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, r.p.errorf(start, "unexpected %q", r.s[start])
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return nil, r.p.errorf(start, "invalid value %q", word)
+}
+
+func (r *relaxedReader) array() (bson.A, error) {
+	r.pos++
+	arr := bson.A{}
+	r.skipSpace()
+	if r.pos < len(r.s) && r.s[r.pos] == ']' {
+		r.pos++
+		return arr, nil
+	}
+	for {
+		value, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+		r.skipSpace()
+		if r.pos < len(r.s) && r.s[r.pos] == ',' {
+			r.pos++
+			continue
+		}
+		if err := r.expect(']'); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+}
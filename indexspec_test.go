@@ -0,0 +1,98 @@
+package modm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseIndex(t *testing.T) {
+	model, err := ParseIndex("name, -age")
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, model.Keys)
+	assert.Nil(t, model.Options)
+
+	model, err = ParseIndex(`email:unique,sparse;partial={deleted_at:null, age:{$gte:18}};name=email_live`)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "email", Value: int32(1)}}, model.Keys)
+	assert.True(t, *model.Options.Unique)
+	assert.True(t, *model.Options.Sparse)
+	assert.Equal(t, "email_live", *model.Options.Name)
+	assert.Equal(t, bson.D{
+		{Key: "deleted_at", Value: nil},
+		{Key: "age", Value: bson.D{{Key: "$gte", Value: int64(18)}}},
+	}, model.Options.PartialFilterExpression)
+
+	model, err = ParseIndex(`title@text,body@text;weights={title:10,'body':2};language=english`)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}, model.Keys)
+	assert.Equal(t, bson.D{{Key: "title", Value: int64(10)}, {Key: "body", Value: int64(2)}}, model.Options.Weights)
+	assert.Equal(t, "english", *model.Options.DefaultLanguage)
+
+	model, err = ParseIndex(`$**;projection={"secret":0}`)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "$**", Value: int32(1)}}, model.Keys)
+	assert.Equal(t, bson.D{{Key: "secret", Value: int64(0)}}, model.Options.WildcardProjection)
+
+	model, err = ParseIndex(`location@2dsphere,attrs.$**`)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "location", Value: "2dsphere"}, {Key: "attrs.$**", Value: int32(1)}}, model.Keys)
+
+	model, err = ParseIndex(`name:hidden;collation={locale:"en",strength:2};ttl=24h`)
+	require.NoError(t, err)
+	assert.True(t, *model.Options.Hidden)
+	assert.Equal(t, &options.Collation{Locale: "en", Strength: 2}, model.Options.Collation)
+	assert.Equal(t, int32(86400), *model.Options.ExpireAfterSeconds)
+}
+
+func TestParseIndex_errors(t *testing.T) {
+	tests := []struct {
+		spec string
+		pos  int
+	}{
+		{"", 0},
+		{"name,", 5},
+		{"name@txt", 5},
+		{"-name@text", 0},
+		{"name:uniq", 5},
+		{"name;nme=x", 5},
+		{"name;weights={name:1}", 5},
+		{"name@text;weights={name:1", 25},
+		{"name;partial={a:}", 16},
+		{"name;partial={a:1} x", 19},
+		{"name;partial={a:'x}", 16},
+		{"name;collation={strength:2}", 15},
+		{"name;ttl=soon", 9},
+		{"name;name=a;name=b", 12},
+		{"name,name", 5},
+		{"a.$**.b", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseIndex(tt.spec)
+			var syntaxErr *IndexSyntaxError
+			require.True(t, errors.As(err, &syntaxErr), "%v", err)
+			assert.Equal(t, tt.pos, syntaxErr.Pos, syntaxErr.Error())
+		})
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	models, err := ParseIndexes([]string{"email;name=email"}, []string{"name,-age"})
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.True(t, *models[0].Options.Unique)
+	assert.Equal(t, "email", *models[0].Options.Name)
+	assert.Nil(t, models[1].Options)
+
+	_, err = ParseIndexes(nil, []string{"name", "age:bad"})
+	assert.Error(t, err)
+	assert.NotPanics(t, func() { IndexesToModel(nil, []string{"name", "age:bad"}) })
+	models = IndexesToModel(nil, []string{"first name", "-age"})
+	require.Len(t, models, 2)
+	assert.Equal(t, bson.D{{Key: "first name", Value: int32(1)}}, models[0].Keys)
+}
@@ -0,0 +1,578 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SyncIndexesOptions configures SyncIndexes.
+type SyncIndexesOptions struct {
+	// DryRun computes the plan without applying it.
+	DryRun bool
+	// Drop drops the indexes that are not declared. By default they are kept.
+	Drop bool
+	// Protect lists the names of indexes that are never dropped or rebuilt. _id_ is always protected.
+	Protect []string
+	// HideBeforeDrop hides undeclared indexes instead of dropping them, so that they can be
+	// unhidden if queries regress. Indexes that are already hidden are dropped. It also applies
+	// to the indexes replaced by a rebuilt index with another name.
+	HideBeforeDrop bool
+	// Indexes replaces the declared indexes of T (see DeclaredIndexes).
+	Indexes []mongo.IndexModel
+}
+
+// IndexChange is a declared index whose existing definition differs.
+type IndexChange struct {
+	// Name is the name of the existing index.
+	Name  string
+	Model mongo.IndexModel
+	// Diffs describes the differences, e.g. "unique: false -> true".
+	Diffs []string
+	// changes are the index options that collMod sets, for a modified index.
+	changes bson.D
+	// previous is the existing definition, as listIndexes reports it, to restore a failed rebuild.
+	previous bson.D
+	hidden   bool
+}
+
+// IndexPlan is the set of changes that brings the indexes of a collection to the declared indexes.
+type IndexPlan struct {
+	// Create lists the declared indexes that do not exist.
+	Create []mongo.IndexModel
+	// Modify lists the changed indexes that are modified in place with collMod: their ttl or
+	// whether they are hidden.
+	Modify []IndexChange
+	// Rebuild lists the changed indexes that are built again with their declared definition.
+	Rebuild []IndexChange
+	// Hide lists the undeclared indexes that are hidden (HideBeforeDrop).
+	Hide []string
+	// Drop lists the undeclared indexes that are dropped.
+	Drop []string
+	// Keep lists the undeclared or changed indexes that are left as they are: protected, or
+	// undeclared while Drop is not set.
+	Keep []string
+	// Duplicates lists, by index name, the duplicates that violate the unique indexes to create
+	// or rebuild. It is only filled in dry-run mode with a duplicate check (see WithDuplicateCheck).
+	Duplicates map[string][]DuplicateGroup
+}
+
+// Empty reports whether the plan has no changes to apply.
+func (p *IndexPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Modify) == 0 && len(p.Rebuild) == 0 && len(p.Hide) == 0 && len(p.Drop) == 0
+}
+
+// DeclaredIndexes returns the indexes declared for T: the Uniques, Indexes and IndexModels
+// methods of T, if it implements Indexes, and of the structs embedded in T, such as a tenant or
+// soft-delete mixin, and the modm struct tags of its fields. Indexes with the same keys are
+// declared once; the declarations of T win over those of its mixins.
+func DeclaredIndexes[T Document]() ([]mongo.IndexModel, error) {
+	model, _ := interface{}(newDocument[T]()).(Indexes)
+	return declaredIndexes[T](model)
+}
+
+// SyncIndexes brings the indexes of the collection to the declared indexes of T (see
+// DeclaredIndexes): it creates the missing indexes, modifies or rebuilds the indexes whose
+// options changed, and drops (or hides) the undeclared ones if opts.Drop is set.
+// It returns the plan, applied unless opts.DryRun is set.
+// A rebuilt index is built before the existing index is dropped (or hidden with
+// opts.HideBeforeDrop). If they cannot coexist, e.g. because they have the same name, the
+// existing index is dropped first, so it is briefly unavailable, and restored if the new
+// index cannot be built.
+// With WithDuplicateCheck, duplicates are handled before unique indexes are created or rebuilt.
+func (r *Repo[T]) SyncIndexes(ctx context.Context, opts SyncIndexesOptions) (*IndexPlan, error) {
+	declared := opts.Indexes
+	if declared == nil {
+		var err error
+		if declared, err = DeclaredIndexes[T](); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateIndexes(declared); err != nil {
+		return nil, err
+	}
+	existing, err := r.listIndexSpecs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planIndexes(declared, existing, opts)
+	if err != nil {
+		return nil, err
+	}
+	building := append([]mongo.IndexModel{}, plan.Create...)
+	for _, change := range plan.Rebuild {
+		building = append(building, change.Model)
+	}
+	if opts.DryRun {
+		return plan, r.reportDuplicates(ctx, plan, building)
+	}
+	if err := r.checkDuplicates(ctx, building); err != nil {
+		return plan, err
+	}
+	return plan, r.applyIndexPlan(ctx, plan, opts.HideBeforeDrop)
+}
+
+// reportDuplicates records the duplicates of the unique indexes of models in plan, if the
+// context has a duplicate check.
+func (r *Repo[T]) reportDuplicates(ctx context.Context, plan *IndexPlan, models []mongo.IndexModel) error {
+	if _, ok := ctx.Value(ctxKeyDuplicates).(DuplicateStrategy); !ok {
+		return nil
+	}
+	for _, model := range models {
+		if !isUniqueIndex(model) {
+			continue
+		}
+		groups, err := r.FindDuplicates(ctx, model)
+		if err != nil {
+			return err
+		}
+		if len(groups) > 0 {
+			if plan.Duplicates == nil {
+				plan.Duplicates = map[string][]DuplicateGroup{}
+			}
+			plan.Duplicates[indexName(model)] = groups
+		}
+	}
+	return nil
+}
+
+// indexSpec is the normalized definition of an index, comparable between declared and existing indexes.
+type indexSpec struct {
+	Name   string
+	Keys   bson.D
+	Hidden bool
+	// Options holds the other options by name, with normalized values.
+	Options map[string]interface{}
+	// raw is the definition reported by listIndexes, for an existing index.
+	raw bson.D
+}
+
+func (r *Repo[T]) listIndexSpecs(ctx context.Context) ([]indexSpec, error) {
+	cursor, err := r.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer cursor.Close(ctx)
+	var specs []indexSpec
+	for cursor.Next(ctx) {
+		var raw bson.D
+		if err := cursor.Decode(&raw); err != nil {
+			return nil, err
+		}
+		specs = append(specs, existingIndexSpec(raw))
+	}
+	return specs, wrapError(cursor.Err())
+}
+
+// existingIndexSpec normalizes an index returned by listIndexes.
+func existingIndexSpec(raw bson.D) indexSpec {
+	spec := indexSpec{Options: map[string]interface{}{}}
+	var weights bson.D
+	for _, e := range raw {
+		switch e.Key {
+		case "name":
+			spec.Name, _ = e.Value.(string)
+		case "key":
+			keys, _ := e.Value.(bson.D)
+			for _, k := range keys {
+				// Text indexes are stored as {_fts: "text", _ftsx: 1}; their fields are the weights.
+				if k.Key == "_fts" || k.Key == "_ftsx" {
+					continue
+				}
+				spec.Keys = append(spec.Keys, bson.E{Key: k.Key, Value: normalizeIndexValue(k.Value)})
+			}
+		case "hidden":
+			spec.Hidden, _ = e.Value.(bool)
+		case "weights":
+			weights, _ = e.Value.(bson.D)
+		case "unique", "sparse", "expireAfterSeconds", "partialFilterExpression", "default_language", "wildcardProjection":
+			spec.Options[e.Key] = normalizeIndexValue(e.Value)
+		case "collation":
+			spec.Options[e.Key] = normalizeIndexValue(e.Value)
+		}
+	}
+	spec.raw = raw
+	for _, w := range weights {
+		spec.Keys = append(spec.Keys, bson.E{Key: w.Key, Value: "text"})
+	}
+	if len(weights) > 0 {
+		spec.Options["weights"] = normalizeIndexValue(weights)
+	}
+	return spec
+}
+
+// declaredIndexSpec normalizes a declared index model like listIndexes reports it.
+func declaredIndexSpec(model mongo.IndexModel) (indexSpec, error) {
+	spec := indexSpec{Options: map[string]interface{}{}}
+	keys, err := toBsonD(model.Keys)
+	if err != nil {
+		return spec, err
+	}
+	var textKeys []string
+	var nameParts []string
+	for _, k := range keys {
+		nameParts = append(nameParts, fmt.Sprintf("%s_%v", k.Key, k.Value))
+		if k.Value == "text" {
+			textKeys = append(textKeys, k.Key)
+			continue
+		}
+		spec.Keys = append(spec.Keys, bson.E{Key: k.Key, Value: normalizeIndexValue(k.Value)})
+	}
+	spec.Name = strings.Join(nameParts, "_")
+	if len(textKeys) > 0 {
+		weights := map[string]interface{}{}
+		for _, key := range textKeys {
+			spec.Keys = append(spec.Keys, bson.E{Key: key, Value: "text"})
+			weights[key] = float64(1)
+		}
+		spec.Options["weights"] = weights
+		spec.Options["default_language"] = "english"
+	}
+	o := model.Options
+	if o == nil {
+		return spec, nil
+	}
+	if o.Name != nil {
+		spec.Name = *o.Name
+	}
+	if o.Unique != nil && *o.Unique {
+		spec.Options["unique"] = true
+	}
+	if o.Sparse != nil && *o.Sparse {
+		spec.Options["sparse"] = true
+	}
+	if o.Hidden != nil {
+		spec.Hidden = *o.Hidden
+	}
+	if o.ExpireAfterSeconds != nil {
+		spec.Options["expireAfterSeconds"] = float64(*o.ExpireAfterSeconds)
+	}
+	if o.DefaultLanguage != nil {
+		spec.Options["default_language"] = *o.DefaultLanguage
+	}
+	if o.Weights != nil {
+		declared, err := toBsonD(o.Weights)
+		if err != nil {
+			return spec, err
+		}
+		weights, _ := spec.Options["weights"].(map[string]interface{})
+		for _, w := range declared {
+			if weights != nil {
+				weights[w.Key] = normalizeIndexValue(w.Value)
+			}
+		}
+	}
+	for name, value := range map[string]interface{}{
+		"partialFilterExpression": o.PartialFilterExpression,
+		"wildcardProjection":      o.WildcardProjection,
+	} {
+		if value != nil {
+			d, err := toBsonD(value)
+			if err != nil {
+				return spec, err
+			}
+			spec.Options[name] = normalizeIndexValue(d)
+		}
+	}
+	if o.Collation != nil {
+		spec.Options["collation"] = collationSpec(o.Collation)
+	}
+	return spec, nil
+}
+
+// toBsonD converts a document of any type to bson.D.
+func toBsonD(doc interface{}) (bson.D, error) {
+	if d, ok := doc.(bson.D); ok {
+		return d, nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	return d, bson.Unmarshal(raw, &d)
+}
+
+// normalizeIndexValue converts numbers to float64 and documents to maps, so that values
+// written by the server compare equal to the declared ones.
+func normalizeIndexValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = normalizeIndexValue(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalizeIndexValue(e)
+		}
+		return m
+	case bson.A:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = normalizeIndexValue(e)
+		}
+		return a
+	}
+	return v
+}
+
+// collationSpec returns the declared fields of a collation. Collation fields that are not set
+// are filled with defaults by the server, so they are not compared.
+func collationSpec(c interface{}) map[string]interface{} {
+	d, _ := toBsonD(c)
+	spec := map[string]interface{}{}
+	for _, e := range d {
+		if v := normalizeIndexValue(e.Value); !reflect.ValueOf(v).IsZero() {
+			spec[strings.ToLower(e.Key)] = v
+		}
+	}
+	return spec
+}
+
+// diffIndexSpecs returns the differences between an existing and a declared index.
+func diffIndexSpecs(existing, declared indexSpec) []string {
+	var diffs []string
+	if existing.Name != declared.Name {
+		diffs = append(diffs, fmt.Sprintf("name: %s -> %s", existing.Name, declared.Name))
+	}
+	if !sameIndexKeys(existing.Keys, declared.Keys) {
+		diffs = append(diffs, fmt.Sprintf("keys: %v -> %v", existing.Keys, declared.Keys))
+	}
+	names := map[string]bool{}
+	for name := range existing.Options {
+		names[name] = true
+	}
+	for name := range declared.Options {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		before, after := existing.Options[name], declared.Options[name]
+		current, ok1 := before.(map[string]interface{})
+		wanted, ok2 := after.(map[string]interface{})
+		if name == "collation" && ok1 && ok2 {
+			// Only compare the declared fields, in lower case as collationSpec reports them.
+			lower := map[string]interface{}{}
+			for k, v := range current {
+				if _, ok := wanted[strings.ToLower(k)]; ok {
+					lower[strings.ToLower(k)] = v
+				}
+			}
+			before = lower
+		}
+		if name == "default_language" && after == nil {
+			continue
+		}
+		if !reflect.DeepEqual(before, after) {
+			diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", name, optionString(before), optionString(after)))
+		}
+	}
+	return diffs
+}
+
+// sameIndexKeys reports whether the normalized keys of two indexes are equal. The order of the
+// keys matters, except between the fields of a text index.
+func sameIndexKeys(a, b bson.D) bool {
+	return reflect.DeepEqual(orderedIndexKeys(a), orderedIndexKeys(b))
+}
+
+// orderedIndexKeys returns keys with the text fields sorted by name, after the other keys.
+func orderedIndexKeys(keys bson.D) bson.D {
+	ordered := bson.D{}
+	var text bson.D
+	for _, k := range keys {
+		if k.Value == "text" {
+			text = append(text, k)
+		} else {
+			ordered = append(ordered, k)
+		}
+	}
+	sort.Slice(text, func(i, j int) bool { return text[i].Key < text[j].Key })
+	return append(ordered, text...)
+}
+
+func optionString(v interface{}) string {
+	if v == nil {
+		return "none"
+	}
+	return fmt.Sprint(v)
+}
+
+// planIndexes computes the plan that brings existing to declared.
+func planIndexes(declared []mongo.IndexModel, existing []indexSpec, opts SyncIndexesOptions) (*IndexPlan, error) {
+	plan := &IndexPlan{}
+	protected := map[string]bool{"_id_": true}
+	for _, name := range opts.Protect {
+		protected[name] = true
+	}
+	matched := map[string]bool{}
+	for _, model := range declared {
+		spec, err := declaredIndexSpec(model)
+		if err != nil {
+			return nil, err
+		}
+		current := findIndexSpec(existing, matched, spec)
+		if current == nil {
+			plan.Create = append(plan.Create, model)
+			continue
+		}
+		matched[current.Name] = true
+		diffs := diffIndexSpecs(*current, spec)
+		change := IndexChange{Name: current.Name, Model: model, Diffs: diffs, previous: current.raw, hidden: current.Hidden}
+		switch {
+		case len(diffs) > 0 && protected[current.Name]:
+			plan.Keep = append(plan.Keep, current.Name)
+		case len(diffs) == 1 && strings.HasPrefix(diffs[0], "expireAfterSeconds:") && current.Options["expireAfterSeconds"] != nil && spec.Options["expireAfterSeconds"] != nil:
+			change.changes = bson.D{{Key: "expireAfterSeconds", Value: *model.Options.ExpireAfterSeconds}}
+			fallthrough
+		case len(diffs) == 0:
+			if current.Hidden != spec.Hidden {
+				change.Diffs = append(change.Diffs, fmt.Sprintf("hidden: %v -> %v", current.Hidden, spec.Hidden))
+				change.changes = append(change.changes, bson.E{Key: "hidden", Value: spec.Hidden})
+			}
+			if len(change.changes) > 0 {
+				plan.Modify = append(plan.Modify, change)
+			}
+		default:
+			plan.Rebuild = append(plan.Rebuild, change)
+		}
+	}
+	for _, spec := range existing {
+		switch {
+		case matched[spec.Name]:
+		case protected[spec.Name] || !opts.Drop:
+			plan.Keep = append(plan.Keep, spec.Name)
+		case opts.HideBeforeDrop && !spec.Hidden:
+			plan.Hide = append(plan.Hide, spec.Name)
+		default:
+			plan.Drop = append(plan.Drop, spec.Name)
+		}
+	}
+	return plan, nil
+}
+
+// findIndexSpec returns the existing index with the name of spec, or else with its keys.
+func findIndexSpec(existing []indexSpec, matched map[string]bool, spec indexSpec) *indexSpec {
+	for i := range existing {
+		if existing[i].Name == spec.Name && !matched[existing[i].Name] {
+			return &existing[i]
+		}
+	}
+	for i := range existing {
+		if !matched[existing[i].Name] && existing[i].Name != "_id_" && sameIndexKeys(existing[i].Keys, spec.Keys) {
+			return &existing[i]
+		}
+	}
+	return nil
+}
+
+// applyIndexPlan applies plan: creates first, then modifies and rebuilds, then hides and drops.
+func (r *Repo[T]) applyIndexPlan(ctx context.Context, plan *IndexPlan, hide bool) error {
+	iv := r.collection.Indexes()
+	if len(plan.Create) > 0 {
+		if _, err := iv.CreateMany(ctx, plan.Create); err != nil {
+			return wrapError(err)
+		}
+	}
+	for _, change := range plan.Modify {
+		if err := r.modifyIndex(ctx, change.Name, change.changes); err != nil {
+			return err
+		}
+	}
+	for _, change := range plan.Rebuild {
+		if err := r.rebuildIndex(ctx, change, hide); err != nil {
+			return err
+		}
+	}
+	for _, name := range plan.Hide {
+		if err := r.modifyIndex(ctx, name, bson.D{{Key: "hidden", Value: true}}); err != nil {
+			return err
+		}
+	}
+	for _, name := range plan.Drop {
+		if _, err := iv.DropOne(ctx, name); err != nil {
+			return wrapError(err)
+		}
+	}
+	return nil
+}
+
+// rebuildIndex replaces the existing index of change with its declared model. The new index is
+// built first, then the existing one is dropped, or hidden if hide is set. If the server rejects
+// the new index because it conflicts with the existing one, the existing index is dropped first
+// and restored from its previous definition if the new index cannot be built.
+func (r *Repo[T]) rebuildIndex(ctx context.Context, change IndexChange, hide bool) error {
+	iv := r.collection.Indexes()
+	spec, err := declaredIndexSpec(change.Model)
+	if err != nil {
+		return err
+	}
+	if spec.Name != change.Name {
+		_, err := iv.CreateOne(ctx, change.Model)
+		if err == nil {
+			if hide && !change.hidden {
+				return r.modifyIndex(ctx, change.Name, bson.D{{Key: "hidden", Value: true}})
+			}
+			_, err = iv.DropOne(ctx, change.Name)
+			return wrapError(err)
+		}
+		if !isIndexConflict(err) {
+			return wrapError(err)
+		}
+	}
+	if _, err := iv.DropOne(ctx, change.Name); err != nil {
+		return wrapError(err)
+	}
+	if _, err := iv.CreateOne(ctx, change.Model); err != nil {
+		if restoreErr := r.restoreIndex(ctx, change.previous); restoreErr != nil {
+			return fmt.Errorf("modm: rebuild of index %s failed (%v) and it could not be restored: %w", change.Name, wrapError(err), restoreErr)
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// restoreIndex creates an index again from its definition reported by listIndexes.
+func (r *Repo[T]) restoreIndex(ctx context.Context, previous bson.D) error {
+	index := bson.D{}
+	for _, e := range previous {
+		if e.Key != "ns" {
+			index = append(index, e)
+		}
+	}
+	cmd := bson.D{{Key: "createIndexes", Value: r.collection.Name()}, {Key: "indexes", Value: bson.A{index}}}
+	return wrapError(r.collection.Database().RunCommand(ctx, cmd).Err())
+}
+
+// isIndexConflict reports whether err is the rejection of an index that conflicts with an
+// existing index with the same keys or name (IndexOptionsConflict, IndexKeySpecsConflict).
+func isIndexConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 85 || cmdErr.Code == 86)
+}
+
+// modifyIndex sets the options of the index name with collMod.
+func (r *Repo[T]) modifyIndex(ctx context.Context, name string, changes bson.D) error {
+	index := append(bson.D{{Key: "name", Value: name}}, changes...)
+	cmd := bson.D{{Key: "collMod", Value: r.collection.Name()}, {Key: "index", Value: index}}
+	return wrapError(r.collection.Database().RunCommand(ctx, cmd).Err())
+}
@@ -0,0 +1,193 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listedIndex returns an index as listIndexes reports it.
+func listedIndex(name string, keys bson.D, opts ...bson.E) indexSpec {
+	raw := bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: keys}, {Key: "name", Value: name}}
+	return existingIndexSpec(append(raw, opts...))
+}
+
+func TestPlanIndexes(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "age", Value: -1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(60)},
+		{Keys: bson.D{{Key: "score", Value: 1}}, Options: options.Index().SetHidden(true)},
+		{Keys: bson.D{{Key: "bio", Value: "text"}}, Options: options.Index().SetWeights(bson.D{{Key: "bio", Value: 5}})},
+	}
+	existing := []indexSpec{
+		listedIndex("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+		listedIndex("name_1", bson.D{{Key: "name", Value: int32(1)}}),
+		listedIndex("email_1", bson.D{{Key: "email", Value: int32(1)}}, bson.E{Key: "expireAfterSeconds", Value: int32(30)}),
+		listedIndex("score_1", bson.D{{Key: "score", Value: int32(1)}}),
+		listedIndex("bio_text", bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			bson.E{Key: "weights", Value: bson.D{{Key: "bio", Value: int32(5)}}},
+			bson.E{Key: "default_language", Value: "english"},
+			bson.E{Key: "language_override", Value: "language"},
+			bson.E{Key: "textIndexVersion", Value: int32(3)}),
+		listedIndex("old_1", bson.D{{Key: "old", Value: int32(1)}}),
+		listedIndex("keep_1", bson.D{{Key: "keep", Value: int32(1)}}),
+	}
+
+	plan, err := planIndexes(declared, existing, SyncIndexesOptions{})
+	require.NoError(t, err)
+	require.Len(t, plan.Create, 1)
+	assert.Equal(t, bson.D{{Key: "age", Value: -1}}, plan.Create[0].Keys)
+	require.Len(t, plan.Rebuild, 1)
+	assert.Equal(t, "name_1", plan.Rebuild[0].Name)
+	assert.Equal(t, []string{"unique: none -> true"}, plan.Rebuild[0].Diffs)
+	require.Len(t, plan.Modify, 2)
+	assert.Equal(t, "email_1", plan.Modify[0].Name)
+	assert.Equal(t, []string{"expireAfterSeconds: 30 -> 60"}, plan.Modify[0].Diffs)
+	assert.Equal(t, bson.D{{Key: "expireAfterSeconds", Value: int32(60)}}, plan.Modify[0].changes)
+	assert.Equal(t, "score_1", plan.Modify[1].Name)
+	assert.Equal(t, bson.D{{Key: "hidden", Value: true}}, plan.Modify[1].changes)
+	assert.Equal(t, []string{"_id_", "old_1", "keep_1"}, plan.Keep)
+	assert.Empty(t, plan.Drop)
+	assert.False(t, plan.Empty())
+
+	plan, err = planIndexes(declared, existing, SyncIndexesOptions{Drop: true, Protect: []string{"keep_1", "name_1"}})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Rebuild)
+	assert.Equal(t, []string{"name_1", "_id_", "keep_1"}, plan.Keep)
+	assert.Equal(t, []string{"old_1"}, plan.Drop)
+
+	existing = append(existing, listedIndex("hidden_1", bson.D{{Key: "hidden", Value: int32(1)}}, bson.E{Key: "hidden", Value: true}))
+	plan, err = planIndexes(declared, existing, SyncIndexesOptions{Drop: true, HideBeforeDrop: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old_1", "keep_1"}, plan.Hide)
+	assert.Equal(t, []string{"hidden_1"}, plan.Drop)
+}
+
+func TestPlanIndexes_inSync(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "age", Value: -1}}, Options: options.Index().SetName("name_age").SetSparse(true)},
+		{Keys: bson.D{{Key: "tenant", Value: 1}}, Options: options.Index().
+			SetPartialFilterExpression(bson.M{"tenant": bson.M{"$exists": true}}).
+			SetCollation(&options.Collation{Locale: "en", Strength: 2})},
+	}
+	existing := []indexSpec{
+		listedIndex("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+		listedIndex("name_age", bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, bson.E{Key: "sparse", Value: true}),
+		listedIndex("tenant_1", bson.D{{Key: "tenant", Value: int32(1)}},
+			bson.E{Key: "partialFilterExpression", Value: bson.D{{Key: "tenant", Value: bson.D{{Key: "$exists", Value: true}}}}},
+			bson.E{Key: "collation", Value: bson.D{{Key: "locale", Value: "en"}, {Key: "caseLevel", Value: false}, {Key: "strength", Value: int32(2)}}}),
+	}
+	plan, err := planIndexes(declared, existing, SyncIndexesOptions{Drop: true})
+	require.NoError(t, err)
+	assert.True(t, plan.Empty())
+	assert.Equal(t, []string{"_id_"}, plan.Keep)
+}
+
+func TestPlanIndexes_renamed(t *testing.T) {
+	declared := []mongo.IndexModel{{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetName("by_name")}}
+	existing := []indexSpec{listedIndex("name_1", bson.D{{Key: "name", Value: int32(1)}})}
+	plan, err := planIndexes(declared, existing, SyncIndexesOptions{})
+	require.NoError(t, err)
+	require.Len(t, plan.Rebuild, 1)
+	assert.Equal(t, "name_1", plan.Rebuild[0].Name)
+	assert.Equal(t, []string{"name: name_1 -> by_name"}, plan.Rebuild[0].Diffs)
+}
+
+func TestPlanIndexes_keyOrder(t *testing.T) {
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 1}}, Options: options.Index().SetName("a_b")},
+		{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}},
+	}
+	existing := []indexSpec{
+		listedIndex("a_b", bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(1)}}),
+		listedIndex("title_text_body_text", bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			bson.E{Key: "weights", Value: bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}}},
+			bson.E{Key: "default_language", Value: "english"}),
+	}
+	plan, err := planIndexes(declared, existing, SyncIndexesOptions{})
+	require.NoError(t, err)
+	require.Len(t, plan.Rebuild, 1)
+	assert.Equal(t, "a_b", plan.Rebuild[0].Name)
+	assert.Equal(t, []string{"keys: [{b 1} {a 1}] -> [{a 1} {b 1}]"}, plan.Rebuild[0].Diffs)
+	assert.Empty(t, plan.Modify)
+	assert.Empty(t, plan.Create)
+}
+
+func TestIsIndexConflict(t *testing.T) {
+	assert.True(t, isIndexConflict(mongo.CommandError{Code: 85}))
+	assert.True(t, isIndexConflict(mongo.CommandError{Code: 86}))
+	assert.False(t, isIndexConflict(mongo.CommandError{Code: 11000}))
+	assert.False(t, isIndexConflict(mongo.ErrNoDocuments))
+}
+
+func TestDeclaredIndexes(t *testing.T) {
+	models, err := DeclaredIndexes[*TestIndexedUser]()
+	require.NoError(t, err)
+	tagModels, err := TagIndexes[*TestIndexedUser]()
+	require.NoError(t, err)
+	assert.Len(t, models, len(tagModels))
+}
+
+func TestRepo_SyncIndexes(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+	ctx := context.Background()
+
+	_, err := repo.Collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "age", Value: 1}}},
+	})
+	require.NoError(t, err)
+
+	declared := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	}
+	plan, err := repo.SyncIndexes(ctx, SyncIndexesOptions{DryRun: true, Drop: true, Indexes: declared})
+	require.NoError(t, err)
+	assert.Len(t, plan.Create, 1)
+	assert.Len(t, plan.Rebuild, 1)
+	assert.Equal(t, []string{"age_1"}, plan.Drop)
+
+	_, err = repo.SyncIndexes(ctx, SyncIndexesOptions{Drop: true, Indexes: declared})
+	require.NoError(t, err)
+	verifyIndexExists(t, repo.Collection().Indexes(), testIndex{Name: "name_1", Key: bson.D{{Key: "name", Value: int32(1)}}, Unique: true})
+	verifyIndexExists(t, repo.Collection().Indexes(), testIndex{Name: "created_at_-1"})
+
+	plan, err = repo.SyncIndexes(ctx, SyncIndexesOptions{DryRun: true, Drop: true, Indexes: declared})
+	require.NoError(t, err)
+	assert.True(t, plan.Empty())
+
+	// A replacement that can coexist is built before the old index is hidden.
+	ci := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true).SetName("name_ci").SetCollation(&options.Collation{Locale: "en", Strength: 2})},
+		declared[1],
+	}
+	plan, err = repo.SyncIndexes(ctx, SyncIndexesOptions{HideBeforeDrop: true, Indexes: ci})
+	require.NoError(t, err)
+	require.Len(t, plan.Rebuild, 1)
+	specs, err := repo.listIndexSpecs(ctx)
+	require.NoError(t, err)
+	hidden := map[string]bool{}
+	for _, spec := range specs {
+		hidden[spec.Name] = spec.Hidden
+	}
+	assert.Equal(t, map[string]bool{"_id_": false, "created_at_-1": false, "name_ci": false, "name_1": true}, hidden)
+
+	// A failed rebuild restores the old index.
+	_, err = repo.Collection().InsertMany(ctx, []interface{}{bson.M{"age": 1}, bson.M{"age": 1}})
+	require.NoError(t, err)
+	_, err = repo.Collection().Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "age", Value: 1}}})
+	require.NoError(t, err)
+	unique := []mongo.IndexModel{{Keys: bson.D{{Key: "age", Value: 1}}, Options: options.Index().SetUnique(true)}}
+	_, err = repo.SyncIndexes(ctx, SyncIndexesOptions{Indexes: unique})
+	require.Error(t, err)
+	verifyIndexExists(t, repo.Collection().Indexes(), testIndex{Name: "age_1", Key: bson.D{{Key: "age", Value: int32(1)}}})
+}
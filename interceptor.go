@@ -0,0 +1,98 @@
+package modm
+
+import (
+	"context"
+	"sync"
+)
+
+// OpKind identifies the kind of repository operation passed through interceptors.
+type OpKind string
+
+const (
+	OpInsertOne              OpKind = "insertOne"
+	OpInsertMany             OpKind = "insertMany"
+	OpDeleteOne              OpKind = "deleteOne"
+	OpDeleteMany             OpKind = "deleteMany"
+	OpUpdateOne              OpKind = "updateOne"
+	OpUpdateMany             OpKind = "updateMany"
+	OpFind                   OpKind = "find"
+	OpFindOne                OpKind = "findOne"
+	OpIter                   OpKind = "iter"
+	OpFindOneAndDelete       OpKind = "findOneAndDelete"
+	OpFindOneAndUpdate       OpKind = "findOneAndUpdate"
+	OpCountDocuments         OpKind = "countDocuments"
+	OpEstimatedDocumentCount OpKind = "estimatedDocumentCount"
+	OpDistinct               OpKind = "distinct"
+	OpAggregate              OpKind = "aggregate"
+	OpAggregateIter          OpKind = "aggregateIter"
+	OpExplain                OpKind = "explain"
+)
+
+// Op describes a single repository operation.
+// Interceptors may inspect or rewrite Filter, Update, Docs and Options before calling next,
+// and inspect Result after it returns.
+type Op struct {
+	Kind       OpKind
+	Collection string
+	// Filter is the query filter. For OpAggregate, OpAggregateIter and OpExplain it holds the pipeline.
+	Filter interface{}
+	// Update is the update document of update operations.
+	Update interface{}
+	// Docs is the document (OpInsertOne) or []interface{} (OpInsertMany) to insert.
+	Docs interface{}
+	// Field is the field name of OpDistinct.
+	Field string
+	// Options is the slice of driver options of the operation, e.g. []*options.FindOptions.
+	Options interface{}
+	// Result is set by the operation: the driver result (e.g. *mongo.UpdateResult),
+	// the decoded documents for find operations, the *mongo.Cursor for OpIter and OpAggregateIter, or the count
+	// for count operations, or the bson.M plan for OpExplain.
+	Result interface{}
+}
+
+// Handler executes an operation.
+type Handler func(ctx context.Context, op *Op) error
+
+// Interceptor wraps the execution of an operation. It calls next to continue the chain,
+// and may call it more than once (e.g. to retry). An interceptor that does not call next
+// must set op.Result itself. Interceptors see the errors of the driver; they are converted
+// to the errors of this package (ErrNotFound, *DuplicateKeyError, ...) after the chain returns.
+type Interceptor func(ctx context.Context, op *Op, next Handler) error
+
+var (
+	interceptorsMu     sync.RWMutex
+	globalInterceptors []Interceptor
+)
+
+// Use registers interceptors that wrap the operations of every repository.
+// Global interceptors run before the interceptors registered on a repository.
+func Use(interceptors ...Interceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+	globalInterceptors = append(globalInterceptors, interceptors...)
+}
+
+// Use registers interceptors that wrap the operations of the repository.
+// It is not safe to call Use concurrently with operations on the repository.
+func (r *Repo[T]) Use(interceptors ...Interceptor) {
+	r.interceptors = append(r.interceptors, interceptors...)
+}
+
+// invoke runs handler through the global and repository interceptor chains.
+func (r *Repo[T]) invoke(ctx context.Context, op *Op, handler Handler) error {
+	op.Collection = r.collection.Name()
+
+	interceptorsMu.RLock()
+	chain := make([]Interceptor, 0, len(globalInterceptors)+len(r.interceptors))
+	chain = append(chain, globalInterceptors...)
+	interceptorsMu.RUnlock()
+	chain = append(chain, r.interceptors...)
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], handler
+		handler = func(ctx context.Context, op *Op) error {
+			return interceptor(ctx, op, next)
+		}
+	}
+	return wrapError(handler(ctx, op))
+}
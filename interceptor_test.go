@@ -0,0 +1,86 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRepo_invoke(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(testURI))
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+	repo := NewRepo[*TestUser](client.Database(testDB).Collection(testColl))
+
+	var calls []string
+	Use(func(ctx context.Context, op *Op, next Handler) error {
+		calls = append(calls, "global")
+		return next(ctx, op)
+	})
+	defer func() { globalInterceptors = nil }()
+	repo.Use(
+		func(ctx context.Context, op *Op, next Handler) error {
+			calls = append(calls, "first")
+			op.Filter = bson.M{"rewritten": true}
+			return next(ctx, op)
+		},
+		func(ctx context.Context, op *Op, next Handler) error {
+			calls = append(calls, "second")
+			// Retry once on failure.
+			if err := next(ctx, op); err != nil {
+				return next(ctx, op)
+			}
+			return nil
+		},
+	)
+
+	attempts := 0
+	op := &Op{Kind: OpFind, Filter: bson.M{}}
+	err = repo.invoke(context.TODO(), op, func(ctx context.Context, op *Op) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("transient")
+		}
+		op.Result = op.Filter
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"global", "first", "second"}, calls)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, testColl, op.Collection)
+	assert.Equal(t, bson.M{"rewritten": true}, op.Result)
+}
+
+func TestRepo_Use(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	var kinds []OpKind
+	repo.Use(func(ctx context.Context, op *Op, next Handler) error {
+		kinds = append(kinds, op.Kind)
+		return next(ctx, op)
+	})
+
+	ctx := context.TODO()
+	_, err := repo.InsertOne(ctx, &TestUser{Name: "go", Age: 2})
+	require.NoError(t, err)
+	_, err = repo.UpdateOne(ctx, bson.M{"name": "go"}, &TestUser{Age: 3})
+	require.NoError(t, err)
+	user, err := repo.FindOne(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), user.Age)
+	count, err := repo.Count(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	_, err = repo.DeleteOne(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []OpKind{OpInsertOne, OpUpdateOne, OpFindOne, OpCountDocuments, OpDeleteOne}, kinds)
+}
@@ -0,0 +1,112 @@
+package modm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Iterator decodes the documents of a cursor one at a time.
+// If T is a Document, AfterFind and AfterFindE run for each document.
+//
+//	it, err := db.Users.Iter(ctx, bson.M{})
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		user := it.Doc()
+//		...
+//	}
+//	return it.Err()
+type Iterator[T any] struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+	hooks  bool
+	doc    T
+	index  int
+	err    error
+}
+
+func newIterator[T any](ctx context.Context, cursor *mongo.Cursor, hooks bool) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, cursor: cursor, hooks: hooks}
+}
+
+// Next decodes the next document. It returns false when the cursor is exhausted, the context is
+// done or an error occurred; check Err to tell them apart.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.err = it.ctx.Err(); it.err != nil {
+		return false
+	}
+	if !it.cursor.Next(it.ctx) {
+		it.err = it.cursor.Err()
+		return false
+	}
+	var doc T
+	if it.err = it.cursor.Decode(&doc); it.err != nil {
+		return false
+	}
+	if d, ok := interface{}(doc).(Document); ok && it.hooks {
+		d.AfterFind(it.ctx)
+		if it.err = runAfterFind(it.ctx, doc, it.index); it.err != nil {
+			return false
+		}
+	}
+	it.doc = doc
+	it.index++
+	return true
+}
+
+// Doc returns the document decoded by the last call to Next.
+func (it *Iterator[T]) Doc() T {
+	return it.doc
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return wrapError(it.err)
+}
+
+// Close closes the underlying cursor.
+func (it *Iterator[T]) Close() error {
+	return it.cursor.Close(context.Background())
+}
+
+// Iter returns an Iterator over the documents that match the filter. The caller must Close it.
+// The batch size of the cursor can be set with options.Find().SetBatchSize.
+// Hooks: AfterFind, AfterFindE
+func (r *Repo[T]) Iter(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*Iterator[T], error) {
+	op := &Op{Kind: OpIter, Filter: r.scope(ctx, filter), Options: opts}
+	err := r.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		opts, _ := op.Options.([]*options.FindOptions)
+		cursor, err := r.collection.Find(ctx, op.Filter, opts...)
+		op.Result = cursor
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	cursor, _ := op.Result.(*mongo.Cursor)
+	return newIterator[T](ctx, cursor, true), nil
+}
+
+// Each calls fn for each document that matches the filter, decoding one document at a time.
+// It stops at the first error returned by fn, or when the context is done.
+// Hooks: AfterFind, AfterFindE
+func (r *Repo[T]) Each(ctx context.Context, filter interface{}, fn func(doc T) error, opts ...*options.FindOptions) error {
+	it, err := r.Iter(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Doc()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,51 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRepo_Iter(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.InsertMany(ctx, []*TestUser{{Name: "go", Age: 2}, {Name: "goo", Age: 3}, {Name: "gooo", Age: 4}})
+	require.NoError(t, err)
+
+	it, err := repo.Iter(ctx, bson.M{}, options.Find().SetBatchSize(1).SetSort(bson.M{"age": 1}))
+	require.NoError(t, err)
+	var bios []string
+	for it.Next() {
+		bios = append(bios, it.Doc().Bio)
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+	assert.Equal(t, []string{"go is 2 years old.", "goo is 3 years old.", "gooo is 4 years old."}, bios)
+
+	errStop := errors.New("stop")
+	var names []string
+	err = repo.Each(ctx, bson.M{}, func(doc *TestUser) error {
+		names = append(names, doc.Name)
+		if len(names) == 2 {
+			return errStop
+		}
+		return nil
+	}, options.Find().SetSort(bson.M{"age": 1}))
+	require.ErrorIs(t, err, errStop)
+	assert.Equal(t, []string{"go", "goo"}, names)
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	err = repo.Each(cancelCtx, bson.M{}, func(doc *TestUser) error {
+		cancel()
+		return nil
+	}, options.Find().SetBatchSize(1))
+	require.ErrorIs(t, err, context.Canceled)
+}
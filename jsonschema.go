@@ -0,0 +1,485 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	dateTimeType   = reflect.TypeOf(primitive.DateTime(0))
+	objectIDType   = reflect.TypeOf(primitive.ObjectID{})
+	decimalType    = reflect.TypeOf(primitive.Decimal128{})
+	binaryType     = reflect.TypeOf(primitive.Binary{})
+	timestampType  = reflect.TypeOf(primitive.Timestamp{})
+	regexType      = reflect.TypeOf(primitive.Regex{})
+	bsonDType      = reflect.TypeOf(bson.D{})
+	bsonMType      = reflect.TypeOf(bson.M{})
+	bsonAType      = reflect.TypeOf(bson.A{})
+	bsonRawType    = reflect.TypeOf(bson.Raw{})
+	rawValueType   = reflect.TypeOf(bson.RawValue{})
+	emptyIfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// fieldRules are the constraints declared in the modm tag of a field:
+//
+//	`modm:"required"`         the field must be present and not null (not zero, see Validate)
+//	`modm:"min=0"`            minimum of a number, or minimum length of a string, an array or a map
+//	`modm:"max=150"`          maximum of a number, or maximum length of a string, an array or a map
+//	`modm:"len=2"`            exact length of a string, an array or a map
+//	`modm:"enum=a|b"`         allowed values, or allowed elements of an array
+//	`modm:"regex=^[a-z]+$"`   pattern of a string; it cannot contain commas (see Validate)
+//	`modm:"email"`            email address
+//
+// Other options are custom validators (see RegisterValidator), or index and sequence options;
+// unknown options are an error.
+type fieldRules struct {
+	required bool
+	min, max *float64
+	enum     []interface{}
+	pattern  *regexp.Regexp
+	email    bool
+	custom   []tagOption
+}
+
+// nonRuleOptions are the modm tag options that are not validation rules.
+var nonRuleOptions = map[string]bool{
+	"index": true, "unique": true, "sparse": true, "ttl": true, "text": true, "2dsphere": true, "seq": true,
+}
+
+func parseFieldRules(path string, t reflect.Type, tag modmTag) (fieldRules, error) {
+	var rules fieldRules
+	rules.required = tag.Has("required")
+	rules.email = tag.Has("email")
+	for _, key := range []string{"min", "max", "len"} {
+		value, ok := tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return rules, fmt.Errorf("modm: field %s: invalid %s %q", path, key, value)
+		}
+		switch key {
+		case "min":
+			rules.min = &n
+		case "max":
+			rules.max = &n
+		default:
+			rules.min, rules.max = &n, &n
+		}
+	}
+	if value, ok := tag.Lookup("regex"); ok {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return rules, fmt.Errorf("modm: field %s: invalid regex %q: %v", path, value, err)
+		}
+		rules.pattern = re
+	}
+	for i, opt := range tag {
+		switch opt.Key {
+		case "required", "email", "min", "max", "len", "regex", "enum":
+			continue
+		}
+		if nonRuleOptions[opt.Key] {
+			continue
+		}
+		if _, ok := validators.Load(opt.Key); ok {
+			rules.custom = append(rules.custom, opt)
+			continue
+		}
+		if i > 0 && tag[i-1].Key == "regex" {
+			return rules, fmt.Errorf("modm: field %s: unknown option %q after regex %q; regex patterns cannot contain commas", path, opt.Key, tag[i-1].Value)
+		}
+		return rules, fmt.Errorf("modm: field %s: unknown option %q", path, opt.Key)
+	}
+	if value, ok := tag.Lookup("enum"); ok {
+		elem := indirectType(t)
+		if isArrayType(elem) {
+			elem = indirectType(elem.Elem())
+		}
+		for _, s := range strings.Split(value, "|") {
+			v, err := parseEnumValue(elem, s)
+			if err != nil {
+				return rules, fmt.Errorf("modm: field %s: invalid enum value %q", path, s)
+			}
+			rules.enum = append(rules.enum, v)
+		}
+	}
+	return rules, nil
+}
+
+// parseEnumValue converts an enum value of a tag to the kind of t.
+func parseEnumValue(t reflect.Type, s string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// schemaNode is the schema of a value, rendered as a $jsonSchema or a standard JSON Schema.
+type schemaNode struct {
+	// types are the BSON types of the value; empty for any type.
+	types    []string
+	nullable bool
+	// properties and required describe an object; values describes the values of a map.
+	properties []schemaProperty
+	required   []string
+	values     *schemaNode
+	// items describes the elements of an array.
+	items    *schemaNode
+	min, max *float64
+	enum     []interface{}
+	pattern  string
+	email    bool
+}
+
+type schemaProperty struct {
+	name string
+	node *schemaNode
+}
+
+func (n *schemaNode) is(types ...string) bool {
+	for _, t := range n.types {
+		for _, u := range types {
+			if t == u {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildSchema returns the schema of the values of type t. stack holds the struct types being
+// built, so that recursive types are described as plain objects.
+func buildSchema(t reflect.Type, path string, stack map[reflect.Type]bool) (*schemaNode, error) {
+	if t.Kind() == reflect.Ptr {
+		n, err := buildSchema(t.Elem(), path, stack)
+		if err == nil {
+			n.nullable = true
+		}
+		return n, err
+	}
+	switch t {
+	case timeType, dateTimeType:
+		return &schemaNode{types: []string{"date"}}, nil
+	case objectIDType:
+		return &schemaNode{types: []string{"objectId"}}, nil
+	case decimalType:
+		return &schemaNode{types: []string{"decimal"}}, nil
+	case binaryType:
+		return &schemaNode{types: []string{"binData"}}, nil
+	case timestampType:
+		return &schemaNode{types: []string{"timestamp"}}, nil
+	case regexType:
+		return &schemaNode{types: []string{"regex"}}, nil
+	case bsonDType, bsonMType, bsonRawType:
+		return &schemaNode{types: []string{"object"}, nullable: true}, nil
+	case bsonAType:
+		return &schemaNode{types: []string{"array"}, nullable: true}, nil
+	case rawValueType, emptyIfaceType:
+		return &schemaNode{}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schemaNode{types: []string{"bool"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// The driver writes integers as int32 when they fit, and as int64 otherwise.
+		return &schemaNode{types: []string{"int", "long"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{types: []string{"double"}}, nil
+	case reflect.String:
+		return &schemaNode{types: []string{"string"}}, nil
+	case reflect.Interface:
+		return &schemaNode{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schemaNode{types: []string{"binData"}, nullable: t.Kind() == reflect.Slice}, nil
+		}
+		items, err := buildSchema(t.Elem(), path+".$", stack)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{types: []string{"array"}, items: items, nullable: t.Kind() == reflect.Slice}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("modm: field %s: unsupported map key type %s", path, t.Key())
+		}
+		values, err := buildSchema(t.Elem(), path+".$", stack)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{types: []string{"object"}, values: values, nullable: true}, nil
+	case reflect.Struct:
+		return buildObjectSchema(t, path, stack)
+	}
+	return nil, fmt.Errorf("modm: field %s: unsupported type %s", path, t)
+}
+
+func buildObjectSchema(t reflect.Type, path string, stack map[reflect.Type]bool) (*schemaNode, error) {
+	n := &schemaNode{types: []string{"object"}}
+	if stack[t] {
+		return n, nil
+	}
+	stack[t] = true
+	defer delete(stack, t)
+	for _, f := range getStructInfo(t).Fields {
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + f.Name
+		}
+		prop, err := buildSchema(f.Type, fieldPath, stack)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := parseFieldRules(fieldPath, f.Type, f.Modm)
+		if err != nil {
+			return nil, err
+		}
+		prop.apply(rules)
+		if rules.required {
+			n.required = append(n.required, f.Name)
+		}
+		n.properties = append(n.properties, schemaProperty{name: f.Name, node: prop})
+	}
+	return n, nil
+}
+
+// apply adds the constraints of rules to the schema of a field.
+func (n *schemaNode) apply(rules fieldRules) {
+	n.min, n.max = rules.min, rules.max
+	if rules.pattern != nil {
+		n.pattern = rules.pattern.String()
+	}
+	n.email = rules.email
+	if rules.required {
+		n.nullable = false
+	}
+	if len(rules.enum) == 0 {
+		return
+	}
+	if n.items != nil {
+		n.items.enum = rules.enum
+		return
+	}
+	n.enum = rules.enum
+	if n.nullable {
+		n.enum = append(n.enum, nil)
+	}
+}
+
+// bson renders the node as a $jsonSchema document.
+func (n *schemaNode) bson() bson.D {
+	d := bson.D{}
+	types := n.types
+	if n.nullable && len(types) > 0 {
+		types = append(append([]string{}, types...), "null")
+	}
+	switch {
+	case len(types) == 1:
+		d = append(d, bson.E{Key: "bsonType", Value: types[0]})
+	case len(types) > 1:
+		a := bson.A{}
+		for _, t := range types {
+			a = append(a, t)
+		}
+		d = append(d, bson.E{Key: "bsonType", Value: a})
+	}
+	if len(n.required) > 0 {
+		a := bson.A{}
+		for _, name := range n.required {
+			a = append(a, name)
+		}
+		d = append(d, bson.E{Key: "required", Value: a})
+	}
+	if len(n.properties) > 0 {
+		props := bson.D{}
+		for _, p := range n.properties {
+			props = append(props, bson.E{Key: p.name, Value: p.node.bson()})
+		}
+		d = append(d, bson.E{Key: "properties", Value: props})
+	}
+	if n.values != nil {
+		d = append(d, bson.E{Key: "additionalProperties", Value: n.values.bson()})
+	}
+	if n.items != nil {
+		d = append(d, bson.E{Key: "items", Value: n.items.bson()})
+	}
+	d = append(d, n.bounds()...)
+	if n.pattern != "" {
+		d = append(d, bson.E{Key: "pattern", Value: n.pattern})
+	}
+	if len(n.enum) > 0 {
+		d = append(d, bson.E{Key: "enum", Value: bson.A(n.enum)})
+	}
+	return d
+}
+
+// bounds returns the min and max constraints with the keywords of the type of the node.
+func (n *schemaNode) bounds() []bson.E {
+	minKey, maxKey := "minimum", "maximum"
+	switch {
+	case n.is("string"):
+		minKey, maxKey = "minLength", "maxLength"
+	case n.is("array"):
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	var bounds []bson.E
+	if n.min != nil {
+		bounds = append(bounds, bson.E{Key: minKey, Value: *n.min})
+	}
+	if n.max != nil {
+		bounds = append(bounds, bson.E{Key: maxKey, Value: *n.max})
+	}
+	return bounds
+}
+
+// jsonTypes maps the BSON types to the types and formats of JSON Schema.
+var jsonTypes = map[string][2]string{
+	"bool":     {"boolean"},
+	"int":      {"integer"},
+	"long":     {"integer"},
+	"double":   {"number"},
+	"decimal":  {"number"},
+	"string":   {"string"},
+	"date":     {"string", "date-time"},
+	"objectId": {"string"},
+	"binData":  {"string"},
+	"object":   {"object"},
+	"array":    {"array"},
+}
+
+// json renders the node as a standard JSON Schema.
+func (n *schemaNode) json() map[string]interface{} {
+	s := map[string]interface{}{}
+	var types []interface{}
+	seen := map[string]bool{}
+	for _, t := range n.types {
+		jt, ok := jsonTypes[t]
+		if !ok || seen[jt[0]] {
+			continue
+		}
+		seen[jt[0]] = true
+		types = append(types, jt[0])
+		if jt[1] != "" {
+			s["format"] = jt[1]
+		}
+		switch t {
+		case "objectId":
+			s["pattern"] = "^[0-9a-f]{24}$"
+		case "binData":
+			s["contentEncoding"] = "base64"
+		}
+	}
+	if n.nullable && len(types) > 0 {
+		types = append(types, "null")
+	}
+	switch {
+	case len(types) == 1:
+		s["type"] = types[0]
+	case len(types) > 1:
+		s["type"] = types
+	}
+	if len(n.required) > 0 {
+		s["required"] = append([]string{}, n.required...)
+	}
+	if len(n.properties) > 0 {
+		props := map[string]interface{}{}
+		for _, p := range n.properties {
+			props[p.name] = p.node.json()
+		}
+		s["properties"] = props
+	}
+	if n.values != nil {
+		s["additionalProperties"] = n.values.json()
+	}
+	if n.items != nil {
+		s["items"] = n.items.json()
+	}
+	for _, bound := range n.bounds() {
+		s[bound.Key] = bound.Value
+	}
+	if n.pattern != "" {
+		s["pattern"] = n.pattern
+	}
+	if n.email {
+		s["format"] = "email"
+	}
+	if len(n.enum) > 0 {
+		s["enum"] = n.enum
+	}
+	return s
+}
+
+func documentSchema[T Document]() (*schemaNode, error) {
+	return buildObjectSchema(documentType[T](), "", map[reflect.Type]bool{})
+}
+
+// documentType returns the struct type of T.
+func documentType[T Document]() reflect.Type {
+	return indirectType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// BSONSchema returns the $jsonSchema of the documents of T, derived from the bson fields of T
+// and the constraints of their modm tags: required, min, max, len, enum=a|b and regex (see
+// Validate). Pointers, slices and maps are nullable. Fields are optional unless tagged required.
+func BSONSchema[T Document]() (bson.D, error) {
+	n, err := documentSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	return n.bson(), nil
+}
+
+// JSONSchema returns the schema of BSONSchema as a standard JSON Schema (draft 2020-12), e.g.
+// for API documentation. Property names are the bson keys; dates are date-time strings and
+// ObjectIDs are hexadecimal strings.
+func JSONSchema[T Document]() (map[string]interface{}, error) {
+	n, err := documentSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	s := n.json()
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = documentType[T]().Name()
+	return s, nil
+}
+
+// InstallSchema sets the BSONSchema of T as the validator of the collection with EnsureCollection,
+// creating the collection if it does not exist. level is "strict" (default), "moderate" or "off",
+// and action is "error" (default) or "warn".
+func (r *Repo[T]) InstallSchema(ctx context.Context, level, action string) error {
+	schema, err := BSONSchema[T]()
+	if err != nil {
+		return err
+	}
+	if level == "" {
+		level = "strict"
+	}
+	if action == "" {
+		action = "error"
+	}
+	_, err = r.EnsureCollection(ctx, CollectionSpec{
+		Validator:        bson.D{{Key: "$jsonSchema", Value: schema}},
+		ValidationLevel:  level,
+		ValidationAction: action,
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package modm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TestSchemaAddress struct {
+	City string `bson:"city" modm:"required"`
+}
+
+type TestSchemaDoc struct {
+	DefaultField `bson:",inline"`
+	Name         string                 `bson:"name" modm:"required,min=1,max=50"`
+	Age          int                    `bson:"age,omitempty" modm:"min=0,max=150"`
+	Score        float64                `bson:"score"`
+	Role         string                 `bson:"role" modm:"enum=admin|user"`
+	Level        *int                   `bson:"level" modm:"enum=1|2|3"`
+	Tags         []string               `bson:"tags" modm:"max=5,enum=a|b"`
+	Owner        *primitive.ObjectID    `bson:"owner"`
+	BornAt       time.Time              `bson:"born_at"`
+	Address      TestSchemaAddress      `bson:"address"`
+	Attributes   map[string]interface{} `bson:"attributes"`
+	Avatar       []byte                 `bson:"avatar"`
+	Friends      []*TestSchemaDoc       `bson:"friends"`
+}
+
+func TestBSONSchema(t *testing.T) {
+	schema, err := BSONSchema[*TestSchemaDoc]()
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"name"}},
+		{Key: "properties", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "bsonType", Value: "objectId"}}},
+			{Key: "created_at", Value: bson.D{{Key: "bsonType", Value: "date"}}},
+			{Key: "updated_at", Value: bson.D{{Key: "bsonType", Value: "date"}}},
+			{Key: "name", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "minLength", Value: float64(1)}, {Key: "maxLength", Value: float64(50)}}},
+			{Key: "age", Value: bson.D{{Key: "bsonType", Value: bson.A{"int", "long"}}, {Key: "minimum", Value: float64(0)}, {Key: "maximum", Value: float64(150)}}},
+			{Key: "score", Value: bson.D{{Key: "bsonType", Value: "double"}}},
+			{Key: "role", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "enum", Value: bson.A{"admin", "user"}}}},
+			{Key: "level", Value: bson.D{{Key: "bsonType", Value: bson.A{"int", "long", "null"}}, {Key: "enum", Value: bson.A{int64(1), int64(2), int64(3), nil}}}},
+			{Key: "tags", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"array", "null"}},
+				{Key: "items", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "enum", Value: bson.A{"a", "b"}}}},
+				{Key: "maxItems", Value: float64(5)},
+			}},
+			{Key: "owner", Value: bson.D{{Key: "bsonType", Value: bson.A{"objectId", "null"}}}},
+			{Key: "born_at", Value: bson.D{{Key: "bsonType", Value: "date"}}},
+			{Key: "address", Value: bson.D{
+				{Key: "bsonType", Value: "object"},
+				{Key: "required", Value: bson.A{"city"}},
+				{Key: "properties", Value: bson.D{{Key: "city", Value: bson.D{{Key: "bsonType", Value: "string"}}}}},
+			}},
+			{Key: "attributes", Value: bson.D{{Key: "bsonType", Value: bson.A{"object", "null"}}, {Key: "additionalProperties", Value: bson.D{}}}},
+			{Key: "avatar", Value: bson.D{{Key: "bsonType", Value: bson.A{"binData", "null"}}}},
+			{Key: "friends", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"array", "null"}},
+				{Key: "items", Value: bson.D{{Key: "bsonType", Value: bson.A{"object", "null"}}}},
+			}},
+		}},
+	}, schema)
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := JSONSchema[*TestSchemaDoc]()
+	require.NoError(t, err)
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", schema["$schema"])
+	assert.Equal(t, "TestSchemaDoc", schema["title"])
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, []string{"name"}, schema["required"])
+
+	props := schema["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "pattern": "^[0-9a-f]{24}$"}, props["_id"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, props["born_at"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": float64(0), "maximum": float64(150)}, props["age"])
+	assert.Equal(t, map[string]interface{}{"type": []interface{}{"integer", "null"}, "enum": []interface{}{int64(1), int64(2), int64(3), nil}}, props["level"])
+	assert.Equal(t, map[string]interface{}{"type": []interface{}{"string", "null"}, "contentEncoding": "base64"}, props["avatar"])
+}
+
+func TestBSONSchema_errors(t *testing.T) {
+	type badEnum struct {
+		DefaultField `bson:",inline"`
+		Age          int `bson:"age" modm:"enum=young|old"`
+	}
+	_, err := BSONSchema[*badEnum]()
+	assert.EqualError(t, err, `modm: field age: invalid enum value "young"`)
+
+	type badMin struct {
+		DefaultField `bson:",inline"`
+		Name         string `bson:"name" modm:"min=x"`
+	}
+	_, err = BSONSchema[*badMin]()
+	assert.EqualError(t, err, `modm: field name: invalid min "x"`)
+
+	type badMap struct {
+		DefaultField `bson:",inline"`
+		Counts       map[int]int `bson:"counts"`
+	}
+	_, err = BSONSchema[*badMap]()
+	assert.EqualError(t, err, "modm: field counts: unsupported map key type int")
+}
+
+func TestRepo_InstallSchema(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestSchemaDoc](db.Collection("install_schema"))
+	ctx := context.Background()
+	defer repo.Collection().Drop(ctx)
+
+	require.NoError(t, repo.InstallSchema(ctx, "", ""))
+	_, err := repo.InsertOne(ctx, &TestSchemaDoc{Name: "Alice", Role: "admin"})
+	require.NoError(t, err)
+	_, err = repo.InsertOne(ctx, &TestSchemaDoc{Name: "Bob", Role: "root"})
+	assert.Error(t, err)
+
+	require.NoError(t, repo.InstallSchema(ctx, "strict", "warn"))
+	_, err = repo.InsertOne(ctx, &TestSchemaDoc{Name: "Bob", Role: "root"})
+	assert.NoError(t, err)
+}
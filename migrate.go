@@ -0,0 +1,287 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection is the collection where a Migrator records the applied migrations and its lock.
+const MigrationsCollection = "modm_migrations"
+
+// LatestVersion is the target of Migrate that applies all the registered migrations.
+const LatestVersion int64 = math.MaxInt64
+
+// ErrMigrationLocked is returned when another Migrator holds the migrations lock.
+var ErrMigrationLocked = errors.New("modm: migrations are locked by another instance")
+
+// Migration is a numbered change of the database. Up applies it and Down reverts it.
+type Migration struct {
+	// Version orders the migrations; it must be positive and unique.
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	// Down is optional; a migration without Down cannot be rolled back.
+	Down func(ctx context.Context, db *mongo.Database) error
+	// Transactional runs Up or Down in a transaction (see DoTransaction), together with the record
+	// of the version, so that a failed migration leaves no change. The context passed to Up and
+	// Down must then be used for all the operations.
+	Transactional bool
+}
+
+// MigrationStatus is the state of a registered or applied migration.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	Applied bool
+	// AppliedAt is the time the migration was applied, if Applied.
+	AppliedAt time.Time
+	// Missing is true for an applied migration that is not registered.
+	Missing bool
+}
+
+// migrationRecord is the document of an applied migration in MigrationsCollection.
+type migrationRecord struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// migrationLockID is the _id of the lock document in MigrationsCollection.
+const migrationLockID = "lock"
+
+// Migrator applies and reverts migrations on a database, one instance at a time.
+//
+//	m := modm.NewMigrator(db)
+//	err := m.Register(modm.Migration{Version: 1, Name: "add user emails", Up: ..., Down: ...})
+//	err = m.Migrate(ctx, modm.LatestVersion)
+type Migrator struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	migrations []Migration
+	lockTTL    time.Duration
+	owner      string
+}
+
+// NewMigrator returns a Migrator for db, recording the migrations in MigrationsCollection.
+func NewMigrator(db *mongo.Database) *Migrator {
+	return &Migrator{
+		db:         db,
+		collection: db.Collection(MigrationsCollection),
+		lockTTL:    10 * time.Minute,
+		owner:      primitive.NewObjectID().Hex(),
+	}
+}
+
+// SetLockTTL sets how long the lock is held without progress before another instance can take
+// it over, e.g. after a crash. It must exceed the duration of the longest migration. Default: 10 minutes.
+func (m *Migrator) SetLockTTL(ttl time.Duration) {
+	m.lockTTL = ttl
+}
+
+// Register adds migrations.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, mig := range migrations {
+		if mig.Version <= 0 || mig.Version == LatestVersion {
+			return fmt.Errorf("modm: invalid migration version %d", mig.Version)
+		}
+		if mig.Up == nil {
+			return fmt.Errorf("modm: migration %d has no Up", mig.Version)
+		}
+		if _, ok := m.migration(mig.Version); ok {
+			return fmt.Errorf("modm: duplicate migration version %d", mig.Version)
+		}
+		m.migrations = append(m.migrations, mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return nil
+}
+
+func (m *Migrator) migration(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Status returns the registered and applied migrations, by version.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var status []MigrationStatus
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if rec, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, rec.AppliedAt
+		}
+		status = append(status, s)
+	}
+	for version, rec := range applied {
+		if _, ok := m.migration(version); !ok {
+			status = append(status, MigrationStatus{Version: version, Name: rec.Name, Applied: true, AppliedAt: rec.AppliedAt, Missing: true})
+		}
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+// Migrate applies the registered migrations up to target, in order, and reverts the applied
+// migrations above target, in reverse order. Use LatestVersion to apply all the migrations.
+// It stops at the first error.
+func (m *Migrator) Migrate(ctx context.Context, target int64) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		var down []int64
+		for version := range applied {
+			if version > target {
+				down = append(down, version)
+			}
+		}
+		sort.Slice(down, func(i, j int) bool { return down[i] > down[j] })
+		for _, version := range down {
+			if err := m.revert(ctx, version); err != nil {
+				return err
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > target {
+				continue
+			}
+			if err := m.run(ctx, mig, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback reverts the last steps applied migrations, in reverse order.
+func (m *Migrator) Rollback(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		for i := 0; i < steps && i < len(versions); i++ {
+			if err := m.revert(ctx, versions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, version int64) error {
+	mig, ok := m.migration(version)
+	if !ok {
+		return fmt.Errorf("modm: applied migration %d is not registered", version)
+	}
+	if mig.Down == nil {
+		return fmt.Errorf("modm: migration %d has no Down", version)
+	}
+	return m.run(ctx, mig, false)
+}
+
+// run applies (up) or reverts a migration and records it, in a transaction if the migration is
+// transactional. The lock is renewed first.
+func (m *Migrator) run(ctx context.Context, mig Migration, up bool) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	fn, action := mig.Up, "up"
+	if !up {
+		fn, action = mig.Down, "down"
+	}
+	apply := func(ctx context.Context) error {
+		if err := fn(ctx, m.db); err != nil {
+			return fmt.Errorf("modm: migration %d %s (%s): %w", mig.Version, action, mig.Name, err)
+		}
+		if up {
+			_, err := m.collection.InsertOne(ctx, migrationRecord{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()})
+			return wrapError(err)
+		}
+		_, err := m.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: mig.Version}})
+		return wrapError(err)
+	}
+	if !mig.Transactional {
+		return apply(ctx)
+	}
+	_, err := DoTransaction(m.db.Client())(ctx, func(sessCtx context.Context) (interface{}, error) {
+		return nil, apply(sessCtx)
+	})
+	return err
+}
+
+// applied returns the applied migrations by version.
+func (m *Migrator) applied(ctx context.Context) (map[int64]migrationRecord, error) {
+	cursor, err := m.collection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$ne", Value: migrationLockID}}}})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, wrapError(err)
+	}
+	applied := make(map[int64]migrationRecord, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// locked runs fn while holding the migrations lock.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	err := fn()
+	// Release the lock even if ctx is done.
+	_, unlockErr := m.collection.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: migrationLockID}, {Key: "owner", Value: m.owner}})
+	if err != nil {
+		return err
+	}
+	return wrapError(unlockErr)
+}
+
+// lock takes or renews the migrations lock. It fails with ErrMigrationLocked if another
+// Migrator holds a lock that has not expired.
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: migrationLockID},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "owner", Value: m.owner}},
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "owner", Value: m.owner},
+		{Key: "expires_at", Value: now.Add(m.lockTTL)},
+	}}}
+	_, err := m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	// The upsert conflicts with the lock document of another owner.
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	return wrapError(err)
+}
@@ -0,0 +1,120 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMigrator_Register(t *testing.T) {
+	noop := func(ctx context.Context, db *mongo.Database) error { return nil }
+	m := &Migrator{}
+	require.NoError(t, m.Register(
+		Migration{Version: 3, Name: "c", Up: noop},
+		Migration{Version: 1, Name: "a", Up: noop},
+		Migration{Version: 2, Name: "b", Up: noop},
+	))
+	var versions []int64
+	for _, mig := range m.migrations {
+		versions = append(versions, mig.Version)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, versions)
+
+	assert.EqualError(t, m.Register(Migration{Version: 2, Up: noop}), "modm: duplicate migration version 2")
+	assert.EqualError(t, m.Register(Migration{Version: 0, Up: noop}), "modm: invalid migration version 0")
+	assert.EqualError(t, m.Register(Migration{Version: LatestVersion, Up: noop}), "modm: invalid migration version 9223372036854775807")
+	assert.EqualError(t, m.Register(Migration{Version: 4}), "modm: migration 4 has no Up")
+	assert.Len(t, m.migrations, 3)
+}
+
+func TestMigrator(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	ctx := context.TODO()
+	users := db.Collection("test_users")
+
+	m := NewMigrator(db)
+	require.NoError(t, m.Register(
+		Migration{
+			Version: 1,
+			Name:    "seed users",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("test_users").InsertOne(ctx, bson.M{"name": "alice"})
+				return err
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("test_users").DeleteMany(ctx, bson.M{})
+				return err
+			},
+		},
+		Migration{
+			Version:       2,
+			Name:          "add user ages",
+			Transactional: true,
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("test_users").UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"age": 18}})
+				return err
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("test_users").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"age": ""}})
+				return err
+			},
+		},
+		Migration{
+			Version: 3,
+			Name:    "broken",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return errors.New("boom")
+			},
+		},
+	))
+
+	require.NoError(t, m.Migrate(ctx, 2))
+	n, err := users.CountDocuments(ctx, bson.M{"age": 18})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 3)
+	assert.True(t, status[0].Applied)
+	assert.True(t, status[1].Applied)
+	assert.False(t, status[1].AppliedAt.IsZero())
+	assert.False(t, status[2].Applied)
+
+	err = m.Migrate(ctx, LatestVersion)
+	assert.EqualError(t, err, "modm: migration 3 up (broken): boom")
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, status[2].Applied)
+
+	// Another instance cannot migrate while the lock is held.
+	require.NoError(t, m.lock(ctx))
+	other := NewMigrator(db)
+	assert.ErrorIs(t, other.Migrate(ctx, LatestVersion), ErrMigrationLocked)
+	_, err = db.Collection(MigrationsCollection).UpdateOne(ctx, bson.M{"_id": migrationLockID}, bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Second)}})
+	require.NoError(t, err)
+	assert.NoError(t, other.Migrate(ctx, LatestVersion))
+	assert.EqualError(t, other.Migrate(ctx, 0), "modm: applied migration 2 is not registered")
+
+	require.NoError(t, m.Migrate(ctx, 2))
+	require.NoError(t, m.Rollback(ctx, 1))
+	n, err = users.CountDocuments(ctx, bson.M{"age": bson.M{"$exists": true}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+
+	// Applied migrations unknown to a Migrator are reported as missing.
+	status, err = NewMigrator(db).Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.Equal(t, MigrationStatus{Version: 1, Name: "seed users", Applied: true, AppliedAt: status[0].AppliedAt, Missing: true}, status[0])
+}
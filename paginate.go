@@ -0,0 +1,303 @@
+package modm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor is returned by Paginate when a cursor token is malformed, has been tampered
+// with, or was issued for a different sort.
+var ErrInvalidCursor = errors.New("modm: invalid page cursor")
+
+// PageMode selects how Paginate pages through the results.
+type PageMode int
+
+const (
+	// PageOffset pages with skip/limit, addressed by PageRequest.Page.
+	PageOffset PageMode = iota
+	// PageKeyset pages after the last item of the previous page, addressed by PageRequest.Cursor.
+	// It stays fast on deep pages and is stable under concurrent inserts. The sort fields must be
+	// present and not null in every document, since null does not compare with $gt/$lt.
+	PageKeyset
+)
+
+// PageRequest describes the page to retrieve with Paginate.
+type PageRequest struct {
+	Mode PageMode
+	// Size is the number of items per page.
+	Size int64
+	// Page is the 1-based page number in PageOffset mode.
+	Page int64
+	// Cursor is the NextCursor of the previous page in PageKeyset mode. Empty for the first page.
+	Cursor string
+	// Sort lists the sort fields in the format of SplitSortField, e.g. []string{"-created_at", "name"}.
+	// _id is appended as a tie-breaker unless it is already included.
+	Sort []string
+	// WithTotal computes the total number of documents that match the filter.
+	WithTotal bool
+	// Facet computes the items and the total in a single aggregation with $facet.
+	Facet bool
+}
+
+// Page is a page of documents returned by Paginate.
+type Page[T Document] struct {
+	Items []T
+	// Total is the number of documents that match the filter, if PageRequest.WithTotal is set.
+	Total   int64
+	HasNext bool
+	// NextCursor is the cursor of the next page in PageKeyset mode, if HasNext.
+	NextCursor string
+}
+
+var (
+	cursorKeyMu sync.RWMutex
+	cursorKey   = randomCursorKey()
+)
+
+func randomCursorKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// SetCursorKey sets the key used to sign page cursors. By default a random key is generated at
+// startup, so cursors are only valid within the process that issued them; set a shared key to
+// accept cursors across instances and restarts.
+func SetCursorKey(key []byte) {
+	cursorKeyMu.Lock()
+	defer cursorKeyMu.Unlock()
+	cursorKey = append([]byte{}, key...)
+}
+
+func signCursor(payload []byte) []byte {
+	cursorKeyMu.RLock()
+	defer cursorKeyMu.RUnlock()
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+type cursorPayload struct {
+	Sort   string          `bson:"s"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+func encodeCursor(sort bson.D, values []bson.RawValue) (string, error) {
+	payload, err := bson.Marshal(cursorPayload{Sort: sortSignature(sort), Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, signCursor(payload)...)), nil
+}
+
+func decodeCursor(token string, sort bson.D) ([]bson.RawValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) <= sha256.Size {
+		return nil, ErrInvalidCursor
+	}
+	payload, sig := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(sig, signCursor(payload)) {
+		return nil, ErrInvalidCursor
+	}
+	var cursor cursorPayload
+	if err := bson.Unmarshal(payload, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sortSignature(sort) || len(cursor.Values) != len(sort) {
+		return nil, ErrInvalidCursor
+	}
+	return cursor.Values, nil
+}
+
+func sortSignature(sort bson.D) string {
+	parts := make([]string, len(sort))
+	for i, e := range sort {
+		parts[i] = fmt.Sprintf("%s:%v", e.Key, e.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageSort returns the sort document of a page request, with _id as tie-breaker.
+func pageSort[T Document](fields []string) (bson.D, error) {
+	docType := reflect.TypeOf((*T)(nil)).Elem()
+	var sort bson.D
+	hasID := false
+	for _, field := range fields {
+		key, dir := SplitSortField(field)
+		if _, err := lookupPath(docType, key); err != nil {
+			return nil, err
+		}
+		hasID = hasID || key == "_id"
+		sort = append(sort, bson.E{Key: key, Value: dir})
+	}
+	if !hasID {
+		sort = append(sort, bson.E{Key: "_id", Value: int32(1)})
+	}
+	return sort, nil
+}
+
+// keysetFilter returns the condition that selects the documents after values in sort order.
+func keysetFilter(sort bson.D, values []bson.RawValue) bson.D {
+	or := make(bson.A, 0, len(sort))
+	for i, e := range sort {
+		cond := make(bson.D, 0, i+1)
+		for j := 0; j < i; j++ {
+			cond = append(cond, bson.E{Key: sort[j].Key, Value: values[j]})
+		}
+		op := "$gt"
+		if e.Value == int32(-1) {
+			op = "$lt"
+		}
+		cond = append(cond, bson.E{Key: e.Key, Value: bson.D{{Key: op, Value: values[i]}}})
+		or = append(or, cond)
+	}
+	return bson.D{{Key: "$or", Value: or}}
+}
+
+// sortValues returns the values of the sort fields of doc, for the cursor of the next page.
+func sortValues(doc interface{}, sort bson.D) ([]bson.RawValue, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]bson.RawValue, len(sort))
+	for i, e := range sort {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// Paginate returns a page of the documents that match the filter, in offset or keyset mode.
+// References requested with Populate are loaded after the hooks, in both the find and facet modes.
+// Hooks: AfterFind, AfterFindE
+func (r *Repo[T]) Paginate(ctx context.Context, filter interface{}, req PageRequest) (Page[T], error) {
+	if req.Size <= 0 {
+		return Page[T]{}, fmt.Errorf("modm: page size must be positive")
+	}
+	sort, err := pageSort[T](req.Sort)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	var skip int64
+	var after bson.D
+	switch req.Mode {
+	case PageOffset:
+		if req.Page > 1 {
+			skip = (req.Page - 1) * req.Size
+		}
+	case PageKeyset:
+		if req.Cursor != "" {
+			values, err := decodeCursor(req.Cursor, sort)
+			if err != nil {
+				return Page[T]{}, err
+			}
+			after = keysetFilter(sort, values)
+		}
+	default:
+		return Page[T]{}, fmt.Errorf("modm: unknown page mode %d", req.Mode)
+	}
+
+	page := Page[T]{}
+	if req.Facet {
+		page.Items, page.Total, err = r.paginateFacet(ctx, filter, after, sort, skip, req.Size+1)
+	} else {
+		itemsFilter := filter
+		if after != nil {
+			itemsFilter = bson.D{{Key: "$and", Value: bson.A{filter, after}}}
+		}
+		opts := options.Find().SetSort(sort).SetSkip(skip).SetLimit(req.Size + 1)
+		page.Items, err = r.Find(ctx, itemsFilter, opts)
+		if err == nil && req.WithTotal {
+			page.Total, err = r.Count(ctx, filter)
+		}
+	}
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	if int64(len(page.Items)) > req.Size {
+		page.HasNext = true
+		page.Items = page.Items[:req.Size]
+		if req.Mode == PageKeyset {
+			values, err := sortValues(page.Items[len(page.Items)-1], sort)
+			if err != nil {
+				return Page[T]{}, err
+			}
+			if page.NextCursor, err = encodeCursor(sort, values); err != nil {
+				return Page[T]{}, err
+			}
+		}
+	}
+	return page, nil
+}
+
+// paginateFacet retrieves the items of a page and the total in a single $facet aggregation.
+// The after condition only applies to the items.
+func (r *Repo[T]) paginateFacet(ctx context.Context, filter interface{}, after bson.D, sort bson.D, skip, limit int64) ([]T, int64, error) {
+	items := mongo.Pipeline{}
+	if after != nil {
+		items = append(items, bson.D{{Key: "$match", Value: after}})
+	}
+	items = append(items, bson.D{{Key: "$sort", Value: sort}})
+	if skip > 0 {
+		items = append(items, bson.D{{Key: "$skip", Value: skip}})
+	}
+	items = append(items, bson.D{{Key: "$limit", Value: limit}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: r.scope(ctx, filter)}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "items", Value: items},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "n"}}}},
+		}}},
+	}
+	var res []struct {
+		Items []T `bson:"items"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+	}
+	if err := r.Aggregate(ctx, pipeline, &res); err != nil {
+		return nil, 0, err
+	}
+	docs := make([]T, 0)
+	var total int64
+	if len(res) > 0 {
+		docs = append(docs, res[0].Items...)
+		if len(res[0].Total) > 0 {
+			total = res[0].Total[0].N
+		}
+	}
+	for i, doc := range docs {
+		doc.AfterFind(ctx)
+		if err := runAfterFind(ctx, doc, i); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := r.populate(ctx, docs); err != nil {
+		return nil, 0, err
+	}
+	return docs, total, nil
+}
@@ -0,0 +1,92 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursor(t *testing.T) {
+	sort, err := pageSort[*TestUser]([]string{"-age", "name"})
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "age", Value: int32(-1)}, {Key: "name", Value: int32(1)}, {Key: "_id", Value: int32(1)}}, sort)
+
+	values, err := sortValues(&TestUser{DefaultField: DefaultField{ID: primitive.NewObjectID()}, Name: "go", Age: 2}, sort)
+	require.NoError(t, err)
+	token, err := encodeCursor(sort, values)
+	require.NoError(t, err)
+
+	decoded, err := decodeCursor(token, sort)
+	require.NoError(t, err)
+	assert.Equal(t, values, decoded)
+
+	// A cursor is bound to its sort and signature.
+	other, err := pageSort[*TestUser]([]string{"age"})
+	require.NoError(t, err)
+	_, err = decodeCursor(token, other)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	tampered := []byte(token)
+	tampered[10] ^= 1
+	_, err = decodeCursor(string(tampered), sort)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = decodeCursor("!", sort)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = pageSort[*TestUser]([]string{"unknown"})
+	assert.Error(t, err)
+}
+
+func TestKeysetFilter(t *testing.T) {
+	sort := bson.D{{Key: "age", Value: int32(-1)}, {Key: "_id", Value: int32(1)}}
+	values := []bson.RawValue{{}, {}}
+	assert.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "age", Value: bson.D{{Key: "$lt", Value: values[0]}}}},
+		bson.D{{Key: "age", Value: values[0]}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: values[1]}}}},
+	}}}, keysetFilter(sort, values))
+}
+
+func TestRepo_Paginate(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	var users []*TestUser
+	for i := 0; i < 7; i++ {
+		users = append(users, &TestUser{Name: fmt.Sprintf("go%d", i), Age: uint(i%3 + 1)})
+	}
+	require.NoError(t, repo.InsertMany(ctx, users))
+
+	for _, facet := range []bool{false, true} {
+		page, err := repo.Paginate(ctx, bson.M{}, PageRequest{Size: 3, Page: 3, Sort: []string{"name"}, WithTotal: true, Facet: facet})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "go6", page.Items[0].Name)
+		assert.Equal(t, "go6 is 1 years old.", page.Items[0].Bio)
+		assert.Equal(t, int64(7), page.Total)
+		assert.False(t, page.HasNext)
+
+		var names []string
+		req := PageRequest{Mode: PageKeyset, Size: 3, Sort: []string{"-age", "name"}, Facet: facet}
+		for {
+			page, err := repo.Paginate(ctx, bson.M{}, req)
+			require.NoError(t, err)
+			for _, item := range page.Items {
+				names = append(names, item.Name)
+			}
+			if !page.HasNext {
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"go2", "go5", "go1", "go4", "go0", "go3", "go6"}, names)
+	}
+
+	_, err := repo.Paginate(ctx, bson.M{}, PageRequest{Size: 0})
+	assert.Error(t, err)
+}
@@ -0,0 +1,330 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline is an aggregation pipeline builder bound to a repository of documents of type T.
+// Fields are given either as bson paths or as pointers to the fields of Model[T](), and field
+// references in expressions ("$age") are checked against T:
+//
+//	u := modm.Model[*User]()
+//	p := db.Users.Pipeline()
+//	p.Match(modm.Where[*User]().Gte(&u.Age, 18)).
+//		Group(p.Ref(&u.Age), bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}).
+//		Sort("-count")
+//	counts, err := modm.All[AgeCount](ctx, p)
+//
+// Fields are checked until a stage reshapes the documents (Group, Project, Count or Stage);
+// fields added by Lookup and AddFields are accepted without checks.
+// Like Aggregate, the pipeline is not restricted to documents that are not soft-deleted.
+type Pipeline[T Document] struct {
+	repo   *Repo[T]
+	stages mongo.Pipeline
+	// typed is true while the documents in the pipeline still have the shape of T.
+	typed bool
+	// added holds the top-level fields added by Lookup and AddFields.
+	added map[string]bool
+	err   error
+}
+
+// Pipeline starts an aggregation pipeline on the collection.
+func (r *Repo[T]) Pipeline() *Pipeline[T] {
+	return &Pipeline[T]{repo: r, typed: true, added: map[string]bool{}}
+}
+
+// path resolves a field of the documents at the current stage.
+func (p *Pipeline[T]) path(field interface{}) (string, error) {
+	if path, ok := field.(string); ok && (!p.typed || p.added[strings.Split(path, ".")[0]]) {
+		return path, nil
+	}
+	if !p.typed {
+		return "", fmt.Errorf("modm: field pointers cannot be used after a stage that reshapes the documents, got %T", field)
+	}
+	path, _, err := resolveField[T](field)
+	return path, err
+}
+
+// typedStage reports whether a stage keeps the shape of T.
+func (p *Pipeline[T]) typedStage(name string) bool {
+	switch name {
+	case "$match", "$sort", "$limit", "$skip", "$lookup", "$unwind", "$addFields":
+		return true
+	}
+	return false
+}
+
+// checkExpr checks the field references ("$field") of an aggregation expression.
+func (p *Pipeline[T]) checkExpr(expr interface{}) error {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") && !strings.HasPrefix(e, "$$") {
+			_, err := p.path(e[1:])
+			return err
+		}
+	case bson.D:
+		for _, elem := range e {
+			if err := p.checkExpr(elem.Value); err != nil {
+				return err
+			}
+		}
+	case bson.M:
+		for _, v := range e {
+			if err := p.checkExpr(v); err != nil {
+				return err
+			}
+		}
+	case bson.A:
+		for _, v := range e {
+			if err := p.checkExpr(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline[T]) add(name string, value interface{}) *Pipeline[T] {
+	p.stages = append(p.stages, bson.D{{Key: name, Value: value}})
+	p.typed = p.typed && p.typedStage(name)
+	return p
+}
+
+// Ref returns the field reference ("$path") of a field of T, for use in expressions.
+func (p *Pipeline[T]) Ref(field interface{}) string {
+	path, _, err := resolveField[T](field)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	return "$" + path
+}
+
+// Match filters the documents ($match). The filter may be a *Filter[T] or a bson filter document;
+// other builders, such as an *Update[T], are rejected.
+func (p *Pipeline[T]) Match(filter interface{}) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	switch f := filter.(type) {
+	case *Filter[T]:
+		d, err := f.Build()
+		if err != nil {
+			p.err = err
+			return p
+		}
+		filter = d
+	case nil:
+		filter = bson.D{}
+	case bson.D, bson.M, bson.Raw, map[string]interface{}:
+	default:
+		p.err = fmt.Errorf("modm: $match requires a *Filter[%s] or a bson filter, got %T", reflect.TypeOf((*T)(nil)).Elem(), filter)
+		return p
+	}
+	return p.add("$match", filter)
+}
+
+// Group groups the documents by the id expression and computes the accumulators ($group), e.g.
+// Group("$age", bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}).
+func (p *Pipeline[T]) Group(id interface{}, accumulators bson.D) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	if p.err = p.checkExpr(id); p.err != nil {
+		return p
+	}
+	if p.err = p.checkExpr(accumulators); p.err != nil {
+		return p
+	}
+	group := append(bson.D{{Key: "_id", Value: id}}, accumulators...)
+	return p.add("$group", group)
+}
+
+// Sort sorts the documents by fields in the format of SplitSortField, e.g. Sort("-age", "name") ($sort).
+func (p *Pipeline[T]) Sort(fields ...string) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	sort := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		key, dir := SplitSortField(field)
+		path, err := p.path(key)
+		if err != nil {
+			p.err = err
+			return p
+		}
+		sort = append(sort, bson.E{Key: path, Value: dir})
+	}
+	return p.add("$sort", sort)
+}
+
+// Project keeps the given fields ($project). A string field prefixed with "-" is excluded instead.
+func (p *Pipeline[T]) Project(fields ...interface{}) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	projection := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		var include interface{} = 1
+		if s, ok := field.(string); ok && strings.HasPrefix(s, "-") {
+			field, include = s[1:], 0
+		}
+		path, err := p.path(field)
+		if err != nil {
+			p.err = err
+			return p
+		}
+		projection = append(projection, bson.E{Key: path, Value: include})
+	}
+	return p.add("$project", projection)
+}
+
+// Lookup joins the documents of the from collection whose foreignField equals localField,
+// as an array in the as field ($lookup).
+func (p *Pipeline[T]) Lookup(from string, localField interface{}, foreignField string, as string) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	path, err := p.path(localField)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.added[strings.Split(as, ".")[0]] = true
+	return p.add("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: path},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// Unwind outputs a document for each element of the array field ($unwind).
+// If preserveEmpty is true, documents where the field is missing, null or empty are kept.
+func (p *Pipeline[T]) Unwind(field interface{}, preserveEmpty bool) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	path, err := p.path(field)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	if !preserveEmpty {
+		return p.add("$unwind", "$"+path)
+	}
+	return p.add("$unwind", bson.D{
+		{Key: "path", Value: "$" + path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+// Limit passes the first n documents ($limit).
+func (p *Pipeline[T]) Limit(n int64) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	return p.add("$limit", n)
+}
+
+// Skip skips the first n documents ($skip).
+func (p *Pipeline[T]) Skip(n int64) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	return p.add("$skip", n)
+}
+
+// AddFields adds or replaces fields computed from expressions ($addFields).
+func (p *Pipeline[T]) AddFields(fields bson.D) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	if p.err = p.checkExpr(fields); p.err != nil {
+		return p
+	}
+	for _, field := range fields {
+		p.added[strings.Split(field.Key, ".")[0]] = true
+	}
+	return p.add("$addFields", fields)
+}
+
+// Count replaces the documents with a single document holding their number in field ($count).
+func (p *Pipeline[T]) Count(field string) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	return p.add("$count", field)
+}
+
+// Stage appends a raw stage. Fields are no longer checked after it.
+func (p *Pipeline[T]) Stage(stage bson.D) *Pipeline[T] {
+	if p.err != nil {
+		return p
+	}
+	p.stages = append(p.stages, stage)
+	p.typed = false
+	return p
+}
+
+// Err returns the first error recorded while building the pipeline.
+func (p *Pipeline[T]) Err() error {
+	return p.err
+}
+
+// Build returns the pipeline, or the first error recorded while building it.
+func (p *Pipeline[T]) Build() (mongo.Pipeline, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return append(mongo.Pipeline{}, p.stages...), nil
+}
+
+// Explain returns the query plan of the pipeline (explain command, queryPlanner verbosity).
+// The command runs through the interceptors as an OpExplain.
+func (p *Pipeline[T]) Explain(ctx context.Context) (bson.M, error) {
+	pipeline, err := p.Build()
+	if err != nil {
+		return nil, err
+	}
+	op := &Op{Kind: OpExplain, Filter: pipeline}
+	err = p.repo.invoke(ctx, op, func(ctx context.Context, op *Op) error {
+		cmd := bson.D{
+			{Key: "explain", Value: bson.D{
+				{Key: "aggregate", Value: p.repo.collection.Name()},
+				{Key: "pipeline", Value: op.Filter},
+				{Key: "cursor", Value: bson.D{}},
+			}},
+			{Key: "verbosity", Value: "queryPlanner"},
+		}
+		var res bson.M
+		if err := p.repo.collection.Database().RunCommand(ctx, cmd).Decode(&res); err != nil {
+			return err
+		}
+		op.Result = res
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, _ := op.Result.(bson.M)
+	return res, nil
+}
+
+// All runs the pipeline and decodes the results into a slice of R. See AggregateAs.
+// Hooks: AfterFind, AfterFindE (with WithAfterFind)
+func All[R any, T Document](ctx context.Context, p *Pipeline[T], opts ...*options.AggregateOptions) ([]R, error) {
+	return AggregateAs[R](ctx, p.repo, p, opts...)
+}
+
+// Iter runs the pipeline and returns an Iterator over the results. See AggregateIter.
+// Hooks: AfterFind, AfterFindE (with WithAfterFind)
+func Iter[R any, T Document](ctx context.Context, p *Pipeline[T], opts ...*options.AggregateOptions) (*Iterator[R], error) {
+	return AggregateIter[R](ctx, p.repo, p, opts...)
+}
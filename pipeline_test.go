@@ -0,0 +1,117 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestPipeline_Build(t *testing.T) {
+	repo := &Repo[*TestProfile]{}
+	m := Model[*TestProfile]()
+
+	p := repo.Pipeline()
+	p.Match(Where[*TestProfile]().Gte(&m.Age, 18)).
+		Lookup("addresses", &m.Address.City, "city", "places").
+		Unwind("places", true).
+		AddFields(bson.D{{Key: "adult", Value: bson.D{{Key: "$gte", Value: bson.A{"$age", 18}}}}}).
+		Sort("-age", "places.name").
+		Group(p.Ref(&m.Age), bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}).
+		Sort("-count").
+		Skip(1).
+		Limit(10)
+	pipeline, err := p.Build()
+	require.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "age", Value: bson.D{{Key: "$gte", Value: 18}}}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "addresses"},
+			{Key: "localField", Value: "address.city"},
+			{Key: "foreignField", Value: "city"},
+			{Key: "as", Value: "places"},
+		}}},
+		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$places"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+		{{Key: "$addFields", Value: bson.D{{Key: "adult", Value: bson.D{{Key: "$gte", Value: bson.A{"$age", 18}}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "age", Value: int32(-1)}, {Key: "places.name", Value: int32(1)}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$age"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: int32(-1)}}}},
+		{{Key: "$skip", Value: int64(1)}},
+		{{Key: "$limit", Value: int64(10)}},
+	}, pipeline)
+
+	pipeline, err = repo.Pipeline().Project(&m.Name, "tags", "-_id").Count("n").Build()
+	require.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$project", Value: bson.D{{Key: "name", Value: 1}, {Key: "tags", Value: 1}, {Key: "_id", Value: 0}}}},
+		{{Key: "$count", Value: "n"}},
+	}, pipeline)
+}
+
+func TestPipeline_Errors(t *testing.T) {
+	repo := &Repo[*TestProfile]{}
+	m := Model[*TestProfile]()
+
+	_, err := repo.Pipeline().Sort("-agee").Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Group("$nmae", bson.D{}).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().AddFields(bson.D{{Key: "n", Value: bson.D{{Key: "$size", Value: "$tagz"}}}}).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Match(Where[*TestProfile]().Eq("nope", 1)).Limit(1).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Count("n").Project(&m.Age).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Match(NewUpdate[*TestProfile]().Inc(&m.Age, 1)).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Match(Where[*TestUser]().Gt("age", 1)).Build()
+	assert.Error(t, err)
+	_, err = repo.Pipeline().Match(bson.M{"age": 1}).Match(nil).Build()
+	assert.NoError(t, err)
+
+	_, err = repo.Pipeline().Group("$age", bson.D{{Key: "total", Value: bson.D{{Key: "$sum", Value: "$$ROOT.score"}}}}).Sort("total").Build()
+	assert.NoError(t, err)
+}
+
+func TestPipeline_All(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.InsertMany(ctx, []*TestUser{{Name: "go", Age: 2}, {Name: "goo", Age: 3}, {Name: "ggo", Age: 3}})
+	require.NoError(t, err)
+
+	type ageCount struct {
+		Age   uint  `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	p := repo.Pipeline()
+	p.Match(Where[*TestUser]().Gt("age", 1)).
+		Group("$age", bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}).
+		Sort("-count")
+	counts, err := All[ageCount](ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, []ageCount{{Age: 3, Count: 2}, {Age: 2, Count: 1}}, counts)
+
+	it, err := Iter[*TestUser](WithAfterFind(ctx), repo.Pipeline().Sort("name").Limit(1))
+	require.NoError(t, err)
+	defer it.Close()
+	require.True(t, it.Next())
+	assert.Equal(t, "ggo is 3 years old.", it.Doc().Bio)
+
+	var explained int
+	repo.Use(func(ctx context.Context, op *Op, next Handler) error {
+		if op.Kind == OpExplain {
+			explained++
+		}
+		return next(ctx, op)
+	})
+	plan, err := p.Explain(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, plan)
+	assert.Equal(t, 1, explained)
+}
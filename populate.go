@@ -0,0 +1,256 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// reference is a reference from the documents of a repository to the documents of another one.
+type reference struct {
+	// parent is the bson path of the struct that holds the reference, empty for the document itself.
+	parent []string
+	// local is the index of the ID field in the parent struct, and many is true if it is an array of IDs.
+	local []int
+	many  bool
+	// target is the index of the field that receives the referenced documents.
+	target []int
+	// load finds the referenced documents by ID, populating them with paths.
+	load func(ctx context.Context, ids bson.A, paths []string) (map[string]reflect.Value, error)
+}
+
+// RegisterRef declares that localField of the documents of from references the _id of the
+// documents of to, so that they can be loaded into targetField with Populate:
+//
+//	type Post struct {
+//		modm.DefaultField `bson:",inline"`
+//		AuthorID primitive.ObjectID   `bson:"author_id"`
+//		Author   *User                `bson:"-"`
+//		TagIDs   []primitive.ObjectID `bson:"tag_ids"`
+//		Tags     []*Tag               `bson:"-"`
+//	}
+//
+//	modm.RegisterRef(db.Posts, "author", "author_id", "Author", db.Users)
+//	modm.RegisterRef(db.Posts, "tags", "tag_ids", "Tags", db.Tags)
+//
+// localField is a bson path, which may go through subdocuments and arrays of subdocuments
+// ("comments.author_id"); targetField is the name of the Go field of the same struct. The target
+// field holds a B for a single ID and a []B for an array of IDs, and should be excluded from bson.
+// References must be registered before the repository is used.
+func RegisterRef[A Document, B Document](from *Repo[A], name string, localField string, targetField string, to *Repo[B]) error {
+	docType := reflect.TypeOf((*A)(nil)).Elem()
+	segments := strings.Split(localField, ".")
+	parentType := indirectType(docType)
+	if len(segments) > 1 {
+		t, err := lookupPath(docType, strings.Join(segments[:len(segments)-1], "."))
+		if err != nil {
+			return err
+		}
+		for parentType = indirectType(t); isArrayType(parentType); {
+			parentType = indirectType(parentType.Elem())
+		}
+	}
+	if parentType.Kind() != reflect.Struct {
+		return fmt.Errorf("modm: reference %q: %q is not in a struct", name, localField)
+	}
+	local, ok := getStructInfo(parentType).byName[segments[len(segments)-1]]
+	if !ok {
+		return fmt.Errorf("modm: reference %q: unknown field %q in %s", name, localField, docType)
+	}
+	target, ok := parentType.FieldByName(targetField)
+	if !ok || target.PkgPath != "" {
+		return fmt.Errorf("modm: reference %q: unknown field %s in %s", name, targetField, parentType)
+	}
+	refType := reflect.TypeOf((*B)(nil)).Elem()
+	ref := &reference{
+		parent: segments[:len(segments)-1],
+		local:  local.Index,
+		many:   isArrayType(local.Type),
+		target: target.Index,
+	}
+	if ref.many && (target.Type.Kind() != reflect.Slice || !refType.AssignableTo(target.Type.Elem())) ||
+		!ref.many && !refType.AssignableTo(target.Type) {
+		return fmt.Errorf("modm: reference %q: cannot load %s into %s %s", name, refType, targetField, target.Type)
+	}
+	ref.load = func(ctx context.Context, ids bson.A, paths []string) (map[string]reflect.Value, error) {
+		docs, err := to.Find(withPopulate(ctx, paths), bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, err
+		}
+		loaded := make(map[string]reflect.Value, len(docs))
+		for _, doc := range docs {
+			id, err := documentID(doc)
+			if err != nil {
+				return nil, err
+			}
+			loaded[idKey(id.Type, id.Value)] = reflect.ValueOf(doc)
+		}
+		return loaded, nil
+	}
+	if from.refs == nil {
+		from.refs = map[string]*reference{}
+	}
+	from.refs[name] = ref
+	return nil
+}
+
+// Populate returns a context that makes Find, FindOne and Get load the referenced documents
+// of the named references (see RegisterRef). A path may continue into the references of the
+// referenced documents, e.g. Populate(ctx, "author.company", "tags").
+// Each reference is loaded with a single $in query.
+func Populate(ctx context.Context, paths ...string) context.Context {
+	prev, _ := ctx.Value(ctxKeyPopulate).([]string)
+	return withPopulate(ctx, append(append([]string{}, prev...), paths...))
+}
+
+func withPopulate(ctx context.Context, paths []string) context.Context {
+	return context.WithValue(ctx, ctxKeyPopulate, paths)
+}
+
+func idKey(t bsontype.Type, data []byte) string {
+	return string(rune(t)) + string(data)
+}
+
+// reference returns the reference that path starts with, and the rest of the path.
+func (r *Repo[T]) reference(path string) (*reference, string) {
+	for name := path; ; {
+		if ref, ok := r.refs[name]; ok {
+			return ref, strings.TrimPrefix(path[len(name):], ".")
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return nil, ""
+		}
+		name = name[:i]
+	}
+}
+
+// populate loads the references requested with Populate into docs.
+func (r *Repo[T]) populate(ctx context.Context, docs []T) error {
+	paths, _ := ctx.Value(ctxKeyPopulate).([]string)
+	if len(paths) == 0 || len(docs) == 0 {
+		return nil
+	}
+	var refs []*reference
+	nested := map[*reference][]string{}
+	for _, path := range paths {
+		ref, rest := r.reference(path)
+		if ref == nil {
+			return fmt.Errorf("modm: unknown reference %q in %s", path, reflect.TypeOf((*T)(nil)).Elem())
+		}
+		if _, ok := nested[ref]; !ok {
+			refs = append(refs, ref)
+			nested[ref] = nil
+		}
+		if rest != "" {
+			nested[ref] = append(nested[ref], rest)
+		}
+	}
+	for _, ref := range refs {
+		if err := ref.populate(ctx, reflect.ValueOf(docs), nested[ref]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ref *reference) populate(ctx context.Context, docs reflect.Value, paths []string) error {
+	var holders []reflect.Value
+	ids := bson.A{}
+	seen := map[string]bool{}
+	walkStructs(docs, ref.parent, func(v reflect.Value) {
+		local, err := v.FieldByIndexErr(ref.local)
+		if err != nil {
+			return
+		}
+		holders = append(holders, v)
+		for _, id := range refIDs(local) {
+			if key := idKey(id.Type, id.Value); !seen[key] {
+				seen[key] = true
+				ids = append(ids, id)
+			}
+		}
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	loaded, err := ref.load(ctx, ids, paths)
+	if err != nil {
+		return err
+	}
+	for _, v := range holders {
+		target, err := v.FieldByIndexErr(ref.target)
+		if err != nil || !target.CanSet() {
+			continue
+		}
+		local, _ := v.FieldByIndexErr(ref.local)
+		ids := refIDs(local)
+		if !ref.many {
+			if len(ids) == 1 {
+				if doc, ok := loaded[idKey(ids[0].Type, ids[0].Value)]; ok {
+					target.Set(doc)
+				}
+			}
+			continue
+		}
+		docs := reflect.MakeSlice(target.Type(), 0, len(ids))
+		for _, id := range ids {
+			if doc, ok := loaded[idKey(id.Type, id.Value)]; ok {
+				docs = reflect.Append(docs, doc)
+			}
+		}
+		target.Set(docs)
+	}
+	return nil
+}
+
+// refIDs returns the non-zero IDs held by a reference field.
+func refIDs(v reflect.Value) []bson.RawValue {
+	var ids []bson.RawValue
+	if isArrayType(v.Type()) {
+		for i := 0; i < v.Len(); i++ {
+			ids = append(ids, refIDs(v.Index(i))...)
+		}
+		return ids
+	}
+	if v.IsZero() {
+		return nil
+	}
+	t, data, err := bson.MarshalValue(v.Interface())
+	if err != nil {
+		return nil
+	}
+	return append(ids, bson.RawValue{Type: t, Value: data})
+}
+
+// walkStructs calls fn for each struct found at path from v, through pointers and arrays.
+func walkStructs(v reflect.Value, path []string, fn func(v reflect.Value)) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch {
+	case isArrayType(v.Type()):
+		for i := 0; i < v.Len(); i++ {
+			walkStructs(v.Index(i), path, fn)
+		}
+	case v.Kind() == reflect.Struct:
+		if len(path) == 0 {
+			fn(v)
+			return
+		}
+		field, ok := getStructInfo(v.Type()).byName[path[0]]
+		if !ok {
+			return
+		}
+		if fv, err := v.FieldByIndexErr(field.Index); err == nil {
+			walkStructs(fv, path[1:], fn)
+		}
+	}
+}
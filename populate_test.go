@@ -0,0 +1,149 @@
+package modm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TestComment struct {
+	AuthorID primitive.ObjectID `bson:"author_id" json:"author_id"`
+	Author   *TestUser          `bson:"-" json:"author"`
+	Text     string             `bson:"text" json:"text"`
+}
+
+type TestPost struct {
+	DefaultField `bson:",inline"`
+	Title        string               `bson:"title" json:"title"`
+	AuthorID     primitive.ObjectID   `bson:"author_id" json:"author_id"`
+	Author       *TestUser            `bson:"-" json:"author"`
+	ReaderIDs    []primitive.ObjectID `bson:"reader_ids" json:"reader_ids"`
+	Readers      []*TestUser          `bson:"-" json:"readers"`
+	Comments     []TestComment        `bson:"comments" json:"comments"`
+	ParentID     primitive.ObjectID   `bson:"parent_id,omitempty" json:"parent_id"`
+	Parent       *TestPost            `bson:"-" json:"parent"`
+}
+
+func TestRegisterRef(t *testing.T) {
+	posts := &Repo[*TestPost]{}
+	users := &Repo[*TestUser]{}
+
+	require.NoError(t, RegisterRef(posts, "author", "author_id", "Author", users))
+	require.NoError(t, RegisterRef(posts, "readers", "reader_ids", "Readers", users))
+	require.NoError(t, RegisterRef(posts, "comments.author", "comments.author_id", "Author", users))
+
+	assert.Error(t, RegisterRef(posts, "x", "author", "Author", users))
+	assert.Error(t, RegisterRef(posts, "x", "author_id", "Writer", users))
+	assert.Error(t, RegisterRef(posts, "x", "author_id", "Readers", users))
+	assert.Error(t, RegisterRef(posts, "x", "reader_ids", "Author", users))
+	assert.Error(t, RegisterRef(posts, "x", "title.id", "Author", users))
+
+	ref, rest := posts.reference("comments.author.company")
+	assert.Equal(t, posts.refs["comments.author"], ref)
+	assert.Equal(t, "company", rest)
+	ref, rest = posts.reference("author")
+	assert.Equal(t, posts.refs["author"], ref)
+	assert.Equal(t, "", rest)
+	ref, _ = posts.reference("comments")
+	assert.Nil(t, ref)
+}
+
+func TestReference_populate(t *testing.T) {
+	posts := &Repo[*TestPost]{}
+	users := &Repo[*TestUser]{}
+	require.NoError(t, RegisterRef(posts, "readers", "reader_ids", "Readers", users))
+	require.NoError(t, RegisterRef(posts, "comments.author", "comments.author_id", "Author", users))
+
+	a, b := &TestUser{Name: "a"}, &TestUser{Name: "b"}
+	a.SetID(primitive.NewObjectID())
+	b.SetID(primitive.NewObjectID())
+	docs := []*TestPost{
+		{ReaderIDs: []primitive.ObjectID{b.ID, a.ID, primitive.NewObjectID()}, Comments: []TestComment{{AuthorID: a.ID}, {}}},
+		{ReaderIDs: []primitive.ObjectID{a.ID}, Comments: []TestComment{{AuthorID: b.ID}}},
+	}
+
+	var requested bson.A
+	fake := func(ctx context.Context, ids bson.A, paths []string) (map[string]reflect.Value, error) {
+		requested = append(requested, ids...)
+		loaded := map[string]reflect.Value{}
+		for _, u := range []*TestUser{a, b} {
+			id := refIDs(reflect.ValueOf(u.ID))[0]
+			loaded[idKey(id.Type, id.Value)] = reflect.ValueOf(u)
+		}
+		return loaded, nil
+	}
+	posts.refs["readers"].load = fake
+	posts.refs["comments.author"].load = fake
+
+	ctx := Populate(context.TODO(), "readers")
+	require.NoError(t, posts.populate(Populate(ctx, "comments.author"), docs))
+	assert.Len(t, requested, 5)
+	assert.Equal(t, []*TestUser{b, a}, docs[0].Readers)
+	assert.Equal(t, []*TestUser{a}, docs[1].Readers)
+	assert.Equal(t, a, docs[0].Comments[0].Author)
+	assert.Nil(t, docs[0].Comments[1].Author)
+	assert.Equal(t, b, docs[1].Comments[0].Author)
+
+	assert.Error(t, posts.populate(Populate(context.TODO(), "nope"), docs))
+}
+
+func TestRepo_Populate(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	users := NewRepo[*TestUser](db.Collection(testColl))
+	posts := NewRepo[*TestPost](db.Collection("test_posts"))
+	require.NoError(t, RegisterRef(posts, "author", "author_id", "Author", users))
+	require.NoError(t, RegisterRef(posts, "readers", "reader_ids", "Readers", users))
+	require.NoError(t, RegisterRef(posts, "comments.author", "comments.author_id", "Author", users))
+	require.NoError(t, RegisterRef(posts, "parent", "parent_id", "Parent", posts))
+
+	ctx := context.TODO()
+	a, err := users.InsertOne(ctx, &TestUser{Name: "go", Age: 2})
+	require.NoError(t, err)
+	b, err := users.InsertOne(ctx, &TestUser{Name: "goo", Age: 3})
+	require.NoError(t, err)
+	parent, err := posts.InsertOne(ctx, &TestPost{Title: "parent", AuthorID: b.ID})
+	require.NoError(t, err)
+	post, err := posts.InsertOne(ctx, &TestPost{
+		Title:     "child",
+		AuthorID:  a.ID,
+		ReaderIDs: []primitive.ObjectID{b.ID, a.ID},
+		Comments:  []TestComment{{AuthorID: b.ID, Text: "hi"}},
+		ParentID:  parent.ID,
+	})
+	require.NoError(t, err)
+
+	got, err := posts.Get(Populate(ctx, "author", "readers", "comments.author", "parent.author"), post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Author)
+	assert.Equal(t, "go", got.Author.Name)
+	assert.Equal(t, "go is 2 years old.", got.Author.Bio)
+	require.Len(t, got.Readers, 2)
+	assert.Equal(t, "goo", got.Readers[0].Name)
+	require.NotNil(t, got.Comments[0].Author)
+	assert.Equal(t, "goo", got.Comments[0].Author.Name)
+	require.NotNil(t, got.Parent)
+	require.NotNil(t, got.Parent.Author)
+	assert.Equal(t, "goo", got.Parent.Author.Name)
+
+	list, err := posts.Find(Populate(ctx, "author"), bson.M{})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	for _, p := range list {
+		assert.NotNil(t, p.Author)
+		assert.Nil(t, p.Parent)
+	}
+
+	page, err := posts.Paginate(Populate(ctx, "author"), bson.M{}, PageRequest{Size: 10, Facet: true})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, int64(2), page.Total)
+	for _, p := range page.Items {
+		assert.NotNil(t, p.Author)
+	}
+}
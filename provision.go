@@ -0,0 +1,319 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionSpec describes the options of a collection for EnsureCollection.
+// Zero values keep the defaults of the server.
+type CollectionSpec struct {
+	// Capped makes the collection capped at CappedSize bytes and, if set, CappedMax documents.
+	Capped     bool
+	CappedSize int64
+	CappedMax  int64
+	// TimeSeries makes the collection a time-series collection.
+	TimeSeries *TimeSeriesSpec
+	// Clustered clusters the collection by _id.
+	Clustered bool
+	// ExpireAfter removes the documents of a time-series or clustered collection after this duration.
+	ExpireAfter time.Duration
+	// Collation is the default collation of the collection.
+	Collation *options.Collation
+	// ChangeStreamImages records the pre- and post-images of the changed documents for change
+	// streams (MongoDB 6.0+).
+	ChangeStreamImages bool
+	// Validator is the document validator, e.g. bson.M{"$jsonSchema": schema}.
+	Validator interface{}
+	// ValidationLevel is "strict" (default), "moderate" or "off".
+	ValidationLevel string
+	// ValidationAction is "error" (default) or "warn".
+	ValidationAction string
+}
+
+// TimeSeriesSpec describes a time-series collection.
+type TimeSeriesSpec struct {
+	TimeField string
+	MetaField string
+	// Granularity is "seconds" (default), "minutes" or "hours".
+	Granularity string
+}
+
+// CollectionChange is a setting of a collection that differs from its CollectionSpec.
+type CollectionChange struct {
+	// Setting is the name of the option, e.g. "validationLevel".
+	Setting string
+	From    interface{}
+	To      interface{}
+}
+
+// CollectionReport is the result of EnsureCollection.
+type CollectionReport struct {
+	// Created is true if the collection did not exist.
+	Created bool
+	// Modified lists the settings changed with collMod.
+	Modified []CollectionChange
+	// Conflicts lists the settings that differ but cannot be changed on an existing collection,
+	// e.g. the collation, clustering or time-series fields. The collection has to be recreated
+	// to apply them.
+	Conflicts []CollectionChange
+}
+
+// EnsureCollection creates the collection with the options of spec, or updates the options of
+// the existing collection with collMod and reports what changed.
+// An inconsistent spec, e.g. Capped without CappedSize, is rejected before any change.
+func (r *Repo[T]) EnsureCollection(ctx context.Context, spec CollectionSpec) (*CollectionReport, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	current, exists, err := r.collectionOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err := r.collection.Database().CreateCollection(ctx, r.collection.Name(), createCollectionOptions(spec))
+		var cmdErr mongo.CommandError
+		// The collection may have been created concurrently; reconcile its options then.
+		if !errors.As(err, &cmdErr) || cmdErr.Code != 48 {
+			return &CollectionReport{Created: err == nil}, wrapError(err)
+		}
+		if current, _, err = r.collectionOptions(ctx); err != nil {
+			return nil, err
+		}
+	}
+	report := &CollectionReport{}
+	collMod := diffCollection(spec, current, report)
+	if len(collMod) > 0 {
+		cmd := append(bson.D{{Key: "collMod", Value: r.collection.Name()}}, collMod...)
+		if err := r.collection.Database().RunCommand(ctx, cmd).Err(); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	return report, nil
+}
+
+// validate checks the consistency of the options of spec.
+func (spec CollectionSpec) validate() error {
+	switch {
+	case spec.Capped && spec.CappedSize <= 0:
+		return errors.New("modm: capped collection requires a positive CappedSize")
+	case !spec.Capped && (spec.CappedSize != 0 || spec.CappedMax != 0):
+		return errors.New("modm: CappedSize and CappedMax require Capped")
+	case spec.CappedMax < 0:
+		return errors.New("modm: CappedMax cannot be negative")
+	case spec.TimeSeries != nil && spec.TimeSeries.TimeField == "":
+		return errors.New("modm: time-series collection requires a TimeField")
+	case spec.ExpireAfter != 0 && spec.TimeSeries == nil && !spec.Clustered:
+		return errors.New("modm: ExpireAfter requires a time-series or clustered collection")
+	case spec.ExpireAfter < 0 || spec.ExpireAfter > 0 && spec.ExpireAfter < time.Second:
+		return fmt.Errorf("modm: invalid ExpireAfter %s", spec.ExpireAfter)
+	}
+	return nil
+}
+
+// collectionOptions returns the options of the collection, and whether it exists.
+func (r *Repo[T]) collectionOptions(ctx context.Context) (bson.D, bool, error) {
+	cursor, err := r.collection.Database().ListCollections(ctx, bson.D{{Key: "name", Value: r.collection.Name()}})
+	if err != nil {
+		return nil, false, wrapError(err)
+	}
+	defer cursor.Close(ctx)
+	if !cursor.Next(ctx) {
+		return nil, false, wrapError(cursor.Err())
+	}
+	var res struct {
+		Options bson.D `bson:"options"`
+	}
+	if err := cursor.Decode(&res); err != nil {
+		return nil, false, err
+	}
+	return res.Options, true, nil
+}
+
+func createCollectionOptions(spec CollectionSpec) *options.CreateCollectionOptions {
+	opts := options.CreateCollection()
+	if spec.Capped {
+		opts.SetCapped(true).SetSizeInBytes(spec.CappedSize)
+		if spec.CappedMax > 0 {
+			opts.SetMaxDocuments(spec.CappedMax)
+		}
+	}
+	if ts := spec.TimeSeries; ts != nil {
+		tsOpts := options.TimeSeries().SetTimeField(ts.TimeField)
+		if ts.MetaField != "" {
+			tsOpts.SetMetaField(ts.MetaField)
+		}
+		if ts.Granularity != "" {
+			tsOpts.SetGranularity(ts.Granularity)
+		}
+		opts.SetTimeSeriesOptions(tsOpts)
+	}
+	if spec.Clustered {
+		opts.SetClusteredIndex(bson.D{{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "unique", Value: true}})
+	}
+	if spec.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int64(spec.ExpireAfter / time.Second))
+	}
+	if spec.Collation != nil {
+		opts.SetCollation(spec.Collation)
+	}
+	if spec.ChangeStreamImages {
+		opts.SetChangeStreamPreAndPostImages(bson.D{{Key: "enabled", Value: true}})
+	}
+	if spec.Validator != nil {
+		opts.SetValidator(spec.Validator)
+	}
+	if spec.ValidationLevel != "" {
+		opts.SetValidationLevel(spec.ValidationLevel)
+	}
+	if spec.ValidationAction != "" {
+		opts.SetValidationAction(spec.ValidationAction)
+	}
+	return opts
+}
+
+// diffCollection compares spec with the current options of the collection, as reported by
+// listCollections. It records the differences in report and returns the collMod options that
+// apply the modifiable ones.
+func diffCollection(spec CollectionSpec, current bson.D, report *CollectionReport) bson.D {
+	opts := map[string]interface{}{}
+	for _, e := range current {
+		opts[e.Key] = normalizeIndexValue(e.Value)
+	}
+	var collMod bson.D
+	modify := func(setting string, from, to interface{}, option bson.E) {
+		report.Modified = append(report.Modified, CollectionChange{Setting: setting, From: from, To: to})
+		collMod = append(collMod, option)
+	}
+	conflict := func(setting string, from, to interface{}) {
+		report.Conflicts = append(report.Conflicts, CollectionChange{Setting: setting, From: from, To: to})
+	}
+
+	capped, _ := opts["capped"].(bool)
+	if capped != spec.Capped {
+		conflict("capped", capped, spec.Capped)
+	} else if capped {
+		// The server rounds the size up to a multiple of 256 bytes.
+		size := float64((spec.CappedSize + 255) / 256 * 256)
+		if opts["size"] != size {
+			modify("cappedSize", opts["size"], size, bson.E{Key: "cappedSize", Value: int64(size)})
+		}
+		if spec.CappedMax > 0 && opts["max"] != float64(spec.CappedMax) {
+			modify("cappedMax", opts["max"], float64(spec.CappedMax), bson.E{Key: "cappedMax", Value: spec.CappedMax})
+		}
+	}
+
+	ts, _ := opts["timeseries"].(map[string]interface{})
+	switch {
+	case (ts != nil) != (spec.TimeSeries != nil):
+		conflict("timeseries", ts, spec.TimeSeries)
+	case ts != nil:
+		if ts["timeField"] != spec.TimeSeries.TimeField {
+			conflict("timeseries.timeField", ts["timeField"], spec.TimeSeries.TimeField)
+		}
+		if meta, _ := ts["metaField"].(string); meta != spec.TimeSeries.MetaField {
+			conflict("timeseries.metaField", ts["metaField"], spec.TimeSeries.MetaField)
+		}
+		if g := spec.TimeSeries.Granularity; g != "" && ts["granularity"] != g {
+			modify("timeseries.granularity", ts["granularity"], g, bson.E{Key: "timeseries", Value: bson.D{{Key: "granularity", Value: g}}})
+		}
+	}
+
+	if clustered := opts["clusteredIndex"] != nil; clustered != spec.Clustered {
+		conflict("clusteredIndex", clustered, spec.Clustered)
+	}
+
+	expire := "off"
+	if spec.ExpireAfter > 0 {
+		expire = fmt.Sprint(int64(spec.ExpireAfter / time.Second))
+	}
+	if ts != nil || spec.Clustered {
+		current := "off"
+		if seconds, ok := opts["expireAfterSeconds"].(float64); ok {
+			current = fmt.Sprint(int64(seconds))
+		}
+		if current != expire {
+			value := interface{}("off")
+			if spec.ExpireAfter > 0 {
+				value = int64(spec.ExpireAfter / time.Second)
+			}
+			modify("expireAfterSeconds", current, expire, bson.E{Key: "expireAfterSeconds", Value: value})
+		}
+	}
+
+	currentCollation, _ := opts["collation"].(map[string]interface{})
+	if currentCollation != nil && currentCollation["locale"] == "simple" {
+		currentCollation = nil
+	}
+	var collation map[string]interface{}
+	if spec.Collation != nil {
+		collation = collationSpec(spec.Collation)
+	}
+	if !collationMatches(currentCollation, collation) {
+		conflict("collation", currentCollation, collation)
+	}
+
+	images := false
+	if doc, ok := opts["changeStreamPreAndPostImages"].(map[string]interface{}); ok {
+		images, _ = doc["enabled"].(bool)
+	}
+	if images != spec.ChangeStreamImages {
+		option := bson.E{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: spec.ChangeStreamImages}}}
+		modify("changeStreamPreAndPostImages", images, spec.ChangeStreamImages, option)
+	}
+
+	currentValidator, _ := opts["validator"].(map[string]interface{})
+	if currentValidator == nil {
+		currentValidator = map[string]interface{}{}
+	}
+	validator := map[string]interface{}{}
+	if spec.Validator != nil {
+		d, _ := toBsonD(spec.Validator)
+		validator = normalizeIndexValue(d).(map[string]interface{})
+	}
+	if !reflect.DeepEqual(currentValidator, validator) {
+		to := spec.Validator
+		if to == nil {
+			to = bson.D{}
+		}
+		modify("validator", currentValidator, validator, bson.E{Key: "validator", Value: to})
+	}
+	for _, setting := range []struct{ name, value, fallback string }{
+		{"validationLevel", spec.ValidationLevel, "strict"},
+		{"validationAction", spec.ValidationAction, "error"},
+	} {
+		current, _ := opts[setting.name].(string)
+		if current == "" {
+			current = setting.fallback
+		}
+		value := setting.value
+		if value == "" {
+			value = setting.fallback
+		}
+		if current != value {
+			modify(setting.name, current, value, bson.E{Key: setting.name, Value: value})
+		}
+	}
+	return collMod
+}
+
+// collationMatches reports whether the current collation of a collection has the declared fields.
+func collationMatches(current, declared map[string]interface{}) bool {
+	if current == nil || declared == nil {
+		return current == nil && declared == nil
+	}
+	lower := collationSpec(current)
+	for k, v := range declared {
+		if !reflect.DeepEqual(lower[k], v) {
+			return false
+		}
+	}
+	return true
+}
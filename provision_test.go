@@ -0,0 +1,158 @@
+package modm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCreateCollectionOptions(t *testing.T) {
+	opts := createCollectionOptions(CollectionSpec{
+		TimeSeries:         &TimeSeriesSpec{TimeField: "ts", MetaField: "sensor", Granularity: "minutes"},
+		ExpireAfter:        24 * time.Hour,
+		ChangeStreamImages: true,
+		Validator:          bson.M{"ts": bson.M{"$type": "date"}},
+		ValidationLevel:    "moderate",
+	})
+	assert.Equal(t, "ts", opts.TimeSeriesOptions.TimeField)
+	assert.Equal(t, "sensor", *opts.TimeSeriesOptions.MetaField)
+	assert.Equal(t, "minutes", *opts.TimeSeriesOptions.Granularity)
+	assert.Equal(t, int64(86400), *opts.ExpireAfterSeconds)
+	assert.NotNil(t, opts.ChangeStreamPreAndPostImages)
+	assert.Equal(t, "moderate", *opts.ValidationLevel)
+	assert.Nil(t, opts.ValidationAction)
+	assert.Nil(t, opts.Capped)
+
+	opts = createCollectionOptions(CollectionSpec{Capped: true, CappedSize: 1 << 20, Clustered: true})
+	assert.True(t, *opts.Capped)
+	assert.Equal(t, int64(1<<20), *opts.SizeInBytes)
+	assert.Nil(t, opts.MaxDocuments)
+	assert.NotNil(t, opts.ClusteredIndex)
+}
+
+func TestCollectionSpec_validate(t *testing.T) {
+	valid := []CollectionSpec{
+		{},
+		{Capped: true, CappedSize: 1024, CappedMax: 10},
+		{TimeSeries: &TimeSeriesSpec{TimeField: "ts"}, ExpireAfter: time.Hour},
+		{Clustered: true, ExpireAfter: time.Hour},
+	}
+	for _, spec := range valid {
+		assert.NoError(t, spec.validate(), spec)
+	}
+	invalid := map[string]CollectionSpec{
+		"modm: capped collection requires a positive CappedSize":           {Capped: true},
+		"modm: CappedSize and CappedMax require Capped":                    {CappedSize: 1024},
+		"modm: CappedMax cannot be negative":                               {Capped: true, CappedSize: 1024, CappedMax: -1},
+		"modm: time-series collection requires a TimeField":                {TimeSeries: &TimeSeriesSpec{}},
+		"modm: ExpireAfter requires a time-series or clustered collection": {ExpireAfter: time.Hour},
+		"modm: invalid ExpireAfter 500ms":                                  {Clustered: true, ExpireAfter: 500 * time.Millisecond},
+		"modm: invalid ExpireAfter -1h0m0s":                                {Clustered: true, ExpireAfter: -time.Hour},
+	}
+	for msg, spec := range invalid {
+		assert.EqualError(t, spec.validate(), msg)
+	}
+}
+
+func TestDiffCollection(t *testing.T) {
+	current := bson.D{
+		{Key: "capped", Value: true},
+		{Key: "size", Value: int32(1024)},
+		{Key: "validator", Value: bson.D{{Key: "name", Value: bson.D{{Key: "$type", Value: "string"}}}}},
+		{Key: "validationLevel", Value: "strict"},
+		{Key: "validationAction", Value: "error"},
+		{Key: "collation", Value: bson.D{{Key: "locale", Value: "en"}, {Key: "caseLevel", Value: false}, {Key: "strength", Value: int32(3)}}},
+	}
+	spec := CollectionSpec{
+		Capped:     true,
+		CappedSize: 1024,
+		Validator:  bson.M{"name": bson.M{"$type": "string"}},
+		Collation:  &options.Collation{Locale: "en"},
+	}
+
+	report := &CollectionReport{}
+	assert.Empty(t, diffCollection(spec, current, report))
+	assert.Empty(t, report.Modified)
+	assert.Empty(t, report.Conflicts)
+
+	spec.CappedSize = 2000
+	spec.CappedMax = 100
+	spec.Validator = nil
+	spec.ValidationAction = "warn"
+	spec.ChangeStreamImages = true
+	spec.Collation = &options.Collation{Locale: "fr"}
+	report = &CollectionReport{}
+	collMod := diffCollection(spec, current, report)
+	assert.Equal(t, bson.D{
+		{Key: "cappedSize", Value: int64(2048)},
+		{Key: "cappedMax", Value: int64(100)},
+		{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: true}}},
+		{Key: "validator", Value: bson.D{}},
+		{Key: "validationAction", Value: "warn"},
+	}, collMod)
+	settings := make([]string, len(report.Modified))
+	for i, c := range report.Modified {
+		settings[i] = c.Setting
+	}
+	assert.Equal(t, []string{"cappedSize", "cappedMax", "changeStreamPreAndPostImages", "validator", "validationAction"}, settings)
+	require.Len(t, report.Conflicts, 1)
+	assert.Equal(t, "collation", report.Conflicts[0].Setting)
+}
+
+func TestDiffCollection_timeSeries(t *testing.T) {
+	current := bson.D{
+		{Key: "timeseries", Value: bson.D{
+			{Key: "timeField", Value: "ts"},
+			{Key: "granularity", Value: "seconds"},
+			{Key: "bucketMaxSpanSeconds", Value: int32(3600)},
+		}},
+		{Key: "expireAfterSeconds", Value: int64(3600)},
+	}
+	spec := CollectionSpec{TimeSeries: &TimeSeriesSpec{TimeField: "ts", MetaField: "sensor", Granularity: "minutes"}, ExpireAfter: 2 * time.Hour}
+	report := &CollectionReport{}
+	collMod := diffCollection(spec, current, report)
+	assert.Equal(t, bson.D{
+		{Key: "timeseries", Value: bson.D{{Key: "granularity", Value: "minutes"}}},
+		{Key: "expireAfterSeconds", Value: int64(7200)},
+	}, collMod)
+	require.Len(t, report.Conflicts, 1)
+	assert.Equal(t, CollectionChange{Setting: "timeseries.metaField", From: nil, To: "sensor"}, report.Conflicts[0])
+
+	report = &CollectionReport{}
+	diffCollection(CollectionSpec{}, current, report)
+	require.Len(t, report.Conflicts, 1)
+	assert.Equal(t, "timeseries", report.Conflicts[0].Setting)
+}
+
+func TestRepo_EnsureCollection(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestUser](db.Collection("ensure_collection"))
+	ctx := context.Background()
+	defer repo.Collection().Drop(ctx)
+
+	spec := CollectionSpec{Validator: bson.M{"name": bson.M{"$type": "string"}}}
+	report, err := repo.EnsureCollection(ctx, spec)
+	require.NoError(t, err)
+	assert.True(t, report.Created)
+
+	report, err = repo.EnsureCollection(ctx, spec)
+	require.NoError(t, err)
+	assert.False(t, report.Created)
+	assert.Empty(t, report.Modified)
+
+	spec.ValidationLevel = "moderate"
+	report, err = repo.EnsureCollection(ctx, spec)
+	require.NoError(t, err)
+	require.Len(t, report.Modified, 1)
+	assert.Equal(t, CollectionChange{Setting: "validationLevel", From: "strict", To: "moderate"}, report.Modified[0])
+
+	report, err = repo.EnsureCollection(ctx, spec)
+	require.NoError(t, err)
+	assert.Empty(t, report.Modified)
+}
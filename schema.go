@@ -0,0 +1,269 @@
+package modm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// structField describes a field of a document struct as it is encoded to BSON.
+type structField struct {
+	// Name is the bson key of the field.
+	Name string
+	// GoName is the name of the Go struct field.
+	GoName string
+	Type   reflect.Type
+	Tag    reflect.StructTag
+	// Index is the index sequence for reflect.Value.FieldByIndex, through inlined structs.
+	Index     []int
+	OmitEmpty bool
+	// Modm is the parsed modm tag of the field.
+	Modm modmTag
+	// Mixin is the type of the inlined struct that declares the field, or nil.
+	Mixin reflect.Type
+}
+
+// structInfo is the flattened list of the bson fields of a struct type.
+type structInfo struct {
+	Fields []*structField
+	byName map[string]*structField
+	// open is true if the struct inlines a map, and therefore accepts any key.
+	open bool
+}
+
+var structInfoCache sync.Map // map[reflect.Type]*structInfo
+
+// getStructInfo returns the bson fields of a struct type, following the tag rules of the driver:
+// the key defaults to the lowercased field name, "-" skips a field and ",inline" flattens a struct or map.
+func getStructInfo(t reflect.Type) *structInfo {
+	if info, ok := structInfoCache.Load(t); ok {
+		return info.(*structInfo)
+	}
+	info := &structInfo{byName: map[string]*structField{}}
+	collectStructFields(info, t, nil, nil)
+	actual, _ := structInfoCache.LoadOrStore(t, info)
+	return actual.(*structInfo)
+}
+
+func collectStructFields(info *structInfo, t reflect.Type, index []int, mixin reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		var omitEmpty, inline bool
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				omitEmpty = true
+			case "inline":
+				inline = true
+			}
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+		if inline {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			switch ft.Kind() {
+			case reflect.Struct:
+				collectStructFields(info, ft, fieldIndex, ft)
+				continue
+			case reflect.Map:
+				info.open = true
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if _, ok := info.byName[name]; ok {
+			continue
+		}
+		field := &structField{
+			Name:      name,
+			GoName:    sf.Name,
+			Type:      sf.Type,
+			Tag:       sf.Tag,
+			Index:     fieldIndex,
+			OmitEmpty: omitEmpty,
+			Modm:      parseModmTag(sf.Tag.Get("modm")),
+			Mixin:     mixin,
+		}
+		info.Fields = append(info.Fields, field)
+		info.byName[name] = field
+	}
+}
+
+// indirectType dereferences pointer types.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isArrayType reports whether t is encoded as a BSON array. Byte slices and arrays (including
+// primitive.ObjectID) are encoded as single values.
+func isArrayType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// isArrayIndex reports whether a path segment addresses an array element:
+// a numeric index or a positional operator ($, $[] or $[identifier]).
+func isArrayIndex(segment string) bool {
+	if segment == "$" || strings.HasPrefix(segment, "$[") && strings.HasSuffix(segment, "]") {
+		return true
+	}
+	_, err := strconv.Atoi(segment)
+	return err == nil
+}
+
+// lookupPath resolves a dotted bson path against a document type and returns the Go type of the
+// addressed value. Arrays may be traversed implicitly or with numeric/positional segments.
+// Paths below maps and interface values cannot be checked and resolve to the interface{} type.
+func lookupPath(t reflect.Type, path string) (reflect.Type, error) {
+	if path == "" {
+		return nil, fmt.Errorf("modm: empty field path")
+	}
+	segments := strings.Split(path, ".")
+	cur := indirectType(t)
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		switch {
+		case isArrayType(cur):
+			if isArrayIndex(segment) {
+				cur = indirectType(cur.Elem())
+				continue
+			}
+			cur = indirectType(cur.Elem())
+			i--
+		case cur.Kind() == reflect.Map:
+			cur = indirectType(cur.Elem())
+		case cur.Kind() == reflect.Interface:
+			return cur, nil
+		case cur.Kind() == reflect.Struct:
+			info := getStructInfo(cur)
+			field, ok := info.byName[segment]
+			if !ok {
+				if info.open {
+					return reflect.TypeOf((*interface{})(nil)).Elem(), nil
+				}
+				return nil, fmt.Errorf("modm: unknown field %q in %s", path, indirectType(t))
+			}
+			cur = field.Type
+			if i < len(segments)-1 {
+				cur = indirectType(cur)
+			}
+		default:
+			return nil, fmt.Errorf("modm: unknown field %q in %s", path, indirectType(t))
+		}
+	}
+	return cur, nil
+}
+
+// fieldPointers maps the address offsets of the fields of a struct (including fields of nested
+// struct values) to their bson paths, so that pointers into a model can be resolved.
+type fieldPointers map[fieldPointerKey]string
+
+type fieldPointerKey struct {
+	offset uintptr
+	typ    reflect.Type
+}
+
+var fieldPointersCache sync.Map // map[reflect.Type]fieldPointers
+
+func getFieldPointers(t reflect.Type) fieldPointers {
+	if fp, ok := fieldPointersCache.Load(t); ok {
+		return fp.(fieldPointers)
+	}
+	fp := fieldPointers{}
+	collectFieldPointers(fp, t, 0, "")
+	actual, _ := fieldPointersCache.LoadOrStore(t, fp)
+	return actual.(fieldPointers)
+}
+
+func collectFieldPointers(fp fieldPointers, t reflect.Type, base uintptr, prefix string) {
+	for _, field := range getStructInfo(t).Fields {
+		offset, cur, direct := base, t, true
+		for _, i := range field.Index {
+			if cur.Kind() != reflect.Struct {
+				// Inlined through a pointer: the field is not part of the struct's memory.
+				direct = false
+				break
+			}
+			sf := cur.Field(i)
+			offset += sf.Offset
+			cur = sf.Type
+		}
+		if !direct {
+			continue
+		}
+		path := prefix + field.Name
+		fp[fieldPointerKey{offset, field.Type}] = path
+		if field.Type.Kind() == reflect.Struct && !isAtomicStruct(field.Type) {
+			collectFieldPointers(fp, field.Type, offset, path+".")
+		}
+	}
+}
+
+// isAtomicStruct reports whether a struct type is encoded as a single BSON value rather than a document.
+func isAtomicStruct(t reflect.Type) bool {
+	return t.PkgPath() == "time" || t.PkgPath() == "go.mongodb.org/mongo-driver/bson/primitive"
+}
+
+var modelCache sync.Map // map[reflect.Type]interface{}
+
+// Model returns a shared instance of T whose field addresses can be passed to the typed
+// builders (Where, Set, ...) in place of bson field names:
+//
+//	u := modm.Model[*User]()
+//	filter := modm.Where[*User]().Eq(&u.Name, "gooooo")
+//
+// The instance must not be modified.
+func Model[T Document]() T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if m, ok := modelCache.Load(t); ok {
+		return m.(T)
+	}
+	m, _ := modelCache.LoadOrStore(t, newDocument[T]())
+	return m.(T)
+}
+
+// resolveField returns the bson path of field for documents of type T.
+// The field is either a bson path, checked against T, or a pointer to a field of Model[T]().
+func resolveField[T Document](field interface{}) (string, reflect.Type, error) {
+	docType := reflect.TypeOf((*T)(nil)).Elem()
+	if path, ok := field.(string); ok {
+		t, err := lookupPath(docType, path)
+		return path, t, err
+	}
+	ptr := reflect.ValueOf(field)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return "", nil, fmt.Errorf("modm: field must be a bson path or a pointer to a field of modm.Model, got %T", field)
+	}
+	model := reflect.ValueOf(Model[T]())
+	if model.Kind() != reflect.Ptr || model.Elem().Kind() != reflect.Struct {
+		return "", nil, fmt.Errorf("modm: field pointers require a pointer to struct document type, got %s", docType)
+	}
+	base, addr := model.Pointer(), ptr.Pointer()
+	if addr >= base && addr < base+model.Elem().Type().Size() {
+		key := fieldPointerKey{addr - base, ptr.Type().Elem()}
+		if path, ok := getFieldPointers(model.Elem().Type())[key]; ok {
+			return path, key.typ, nil
+		}
+	}
+	return "", nil, fmt.Errorf("modm: %T does not point to a bson field of modm.Model[%s]()", field, docType)
+}
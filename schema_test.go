@@ -0,0 +1,89 @@
+package modm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TestAddress struct {
+	City string `bson:"city" json:"city"`
+	Zip  string `bson:"zip,omitempty" json:"zip"`
+}
+
+type TestProfile struct {
+	DefaultField `bson:",inline"`
+	Name         string            `bson:"name,omitempty" json:"name"`
+	Age          uint              `bson:"age,omitempty" json:"age"`
+	Tags         []string          `bson:"tags,omitempty" json:"tags"`
+	Address      TestAddress       `bson:"address" json:"address"`
+	Addresses    []*TestAddress    `bson:"addresses,omitempty" json:"addresses"`
+	Attrs        map[string]string `bson:"attrs,omitempty" json:"attrs"`
+	Nickname     *string           `bson:"nickname,omitempty" json:"nickname"`
+	Score        float64           `json:"score"`
+	Secret       string            `bson:"-" json:"-"`
+}
+
+func TestLookupPath(t *testing.T) {
+	typ := reflect.TypeOf(&TestProfile{})
+	tests := []struct {
+		path string
+		want reflect.Type
+	}{
+		{"_id", reflect.TypeOf(primitive.ObjectID{})},
+		{"created_at", reflect.TypeOf(time.Time{})},
+		{"name", reflect.TypeOf("")},
+		{"score", reflect.TypeOf(float64(0))},
+		{"tags", reflect.TypeOf([]string{})},
+		{"tags.0", reflect.TypeOf("")},
+		{"address.city", reflect.TypeOf("")},
+		{"addresses.city", reflect.TypeOf("")},
+		{"addresses.$[elem].zip", reflect.TypeOf("")},
+		{"attrs.color", reflect.TypeOf("")},
+		{"nickname", reflect.TypeOf((*string)(nil))},
+	}
+	for _, tt := range tests {
+		got, err := lookupPath(typ, tt.path)
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+
+	for _, path := range []string{"", "secret", "Name", "address.country", "created_at.wall", "name.first", "_id.0"} {
+		_, err := lookupPath(typ, path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestResolveField(t *testing.T) {
+	u := Model[*TestProfile]()
+	assert.Same(t, u, Model[*TestProfile]())
+
+	tests := []struct {
+		field interface{}
+		path  string
+	}{
+		{&u.ID, "_id"},
+		{&u.UpdatedAt, "updated_at"},
+		{&u.Age, "age"},
+		{&u.Address, "address"},
+		{&u.Address.City, "address.city"},
+		{&u.Address.Zip, "address.zip"},
+		{&u.Nickname, "nickname"},
+		{"addresses.city", "addresses.city"},
+	}
+	for _, tt := range tests {
+		path, _, err := resolveField[*TestProfile](tt.field)
+		require.NoError(t, err)
+		assert.Equal(t, tt.path, path)
+	}
+
+	other := &TestProfile{}
+	for _, field := range []interface{}{&u.Secret, &other.Age, 42, (*string)(nil), "unknown"} {
+		_, _, err := resolveField[*TestProfile](field)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,186 @@
+package modm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sequence allocates increasing int64 values from a counters collection, with one counter
+// document ({_id: key, seq: last}) per key:
+//
+//	seq := modm.NewSequence(db.Collection("counters"))
+//	n, err := seq.Next(ctx, "orders")
+//
+// Values are unique but may have gaps, e.g. when a block is not used up.
+type Sequence struct {
+	collection *mongo.Collection
+	blockSize  int64
+
+	mu     sync.Mutex
+	blocks map[string]*sequenceBlock
+}
+
+// sequenceBlock is a range of pre-allocated values.
+type sequenceBlock struct {
+	next, last int64
+}
+
+// NewSequence creates a Sequence backed by the given counters collection.
+func NewSequence(collection *mongo.Collection) *Sequence {
+	return &Sequence{collection: collection, blockSize: 1, blocks: map[string]*sequenceBlock{}}
+}
+
+// SetBlockSize makes the Sequence allocate n values per round trip and hand them out from
+// memory. Unused values of a block are lost when the process exits.
+// Inside a transaction values are always allocated in the transaction, one round trip per call,
+// so that they are released if it aborts.
+func (s *Sequence) SetBlockSize(n int64) {
+	if n < 1 {
+		n = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockSize = n
+}
+
+// Next returns the next value of the sequence key.
+func (s *Sequence) Next(ctx context.Context, key string) (int64, error) {
+	values, err := s.NextN(ctx, key, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// NextN returns the next n values of the sequence key, in increasing order.
+func (s *Sequence) NextN(ctx context.Context, key string, n int) ([]int64, error) {
+	values := make([]int64, 0, n)
+	if n <= 0 {
+		return values, nil
+	}
+	if mongo.SessionFromContext(ctx) != nil {
+		last, err := s.allocate(ctx, key, int64(n))
+		if err != nil {
+			return nil, err
+		}
+		for v := last - int64(n) + 1; v <= last; v++ {
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	block := s.blocks[key]
+	for len(values) < n {
+		if block == nil || block.next > block.last {
+			size := s.blockSize
+			if remaining := int64(n - len(values)); remaining > size {
+				size = remaining
+			}
+			last, err := s.allocate(ctx, key, size)
+			if err != nil {
+				return nil, err
+			}
+			block = &sequenceBlock{next: last - size + 1, last: last}
+			s.blocks[key] = block
+		}
+		values = append(values, block.next)
+		block.next++
+	}
+	return values, nil
+}
+
+// allocate increments the counter of key by n and returns its new value.
+func (s *Sequence) allocate(ctx context.Context, key string, n int64) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"seq": n}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Seq, wrapError(err)
+}
+
+// SetSequence sets the Sequence that assigns the fields tagged with `modm:"seq=key"` on insert:
+//
+//	type Order struct {
+//		modm.DefaultField `bson:",inline"`
+//		Number int64 `bson:"number" modm:"seq=orders"`
+//	}
+//
+// A field is only assigned if it is zero. It is not safe to call SetSequence concurrently with
+// operations on the repository.
+func (r *Repo[T]) SetSequence(seq *Sequence) {
+	r.sequence = seq
+}
+
+// sequenceFields returns the fields of T tagged with a sequence key.
+func sequenceFields(t reflect.Type) []*structField {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []*structField
+	for _, field := range getStructInfo(t).Fields {
+		if field.Modm.Has("seq") {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// assignSequences assigns the next sequence values to the zero sequence fields of docs.
+func (r *Repo[T]) assignSequences(ctx context.Context, docs []T) error {
+	fields := sequenceFields(reflect.TypeOf((*T)(nil)).Elem())
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, field := range fields {
+		key, _ := field.Modm.Lookup("seq")
+		var targets []reflect.Value
+		for _, doc := range docs {
+			v := reflect.ValueOf(doc)
+			if v.Kind() != reflect.Ptr || v.IsNil() {
+				return fmt.Errorf("modm: sequence field %s requires a pointer document", field.GoName)
+			}
+			fv, err := v.Elem().FieldByIndexErr(field.Index)
+			if err != nil || !fv.IsZero() {
+				continue
+			}
+			switch fv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return fmt.Errorf("modm: sequence field %s must be an integer, got %s", field.GoName, fv.Type())
+			}
+			targets = append(targets, fv)
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		if r.sequence == nil {
+			return fmt.Errorf("modm: field %s has sequence %q but the repository has no Sequence", field.GoName, key)
+		}
+		values, err := r.sequence.NextN(ctx, key, len(targets))
+		if err != nil {
+			return err
+		}
+		for i, fv := range targets {
+			if fv.Kind() >= reflect.Uint && fv.Kind() <= reflect.Uint64 {
+				fv.SetUint(uint64(values[i]))
+			} else {
+				fv.SetInt(values[i])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TestInvoice struct {
+	DefaultField `bson:",inline"`
+	Number       int64  `bson:"number" json:"number" modm:"seq=invoices"`
+	Line         uint32 `bson:"line" json:"line" modm:"seq=lines"`
+}
+
+func TestSequence(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	seq := NewSequence(db.Collection("test_counters"))
+
+	ctx := context.TODO()
+	n, err := seq.Next(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	values, err := seq.NextN(ctx, "a", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 4}, values)
+	n, err = seq.Next(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	seq.SetBlockSize(10)
+	values, err = seq.NextN(ctx, "a", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 6}, values)
+	other := NewSequence(db.Collection("test_counters"))
+	n, err = other.Next(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), n)
+	n, err = seq.Next(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+}
+
+func TestRepo_SetSequence(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestInvoice](db.Collection(testColl))
+
+	ctx := context.TODO()
+	_, err := repo.InsertOne(ctx, &TestInvoice{})
+	require.Error(t, err)
+
+	repo.SetSequence(NewSequence(db.Collection("test_counters")))
+	invoice, err := repo.InsertOne(ctx, &TestInvoice{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), invoice.Number)
+	assert.Equal(t, uint32(1), invoice.Line)
+
+	invoices := []*TestInvoice{{}, {Number: 100}, {}}
+	require.NoError(t, repo.InsertMany(ctx, invoices))
+	assert.Equal(t, int64(2), invoices[0].Number)
+	assert.Equal(t, int64(100), invoices[1].Number)
+	assert.Equal(t, int64(3), invoices[2].Number)
+	assert.Equal(t, uint32(4), invoices[2].Line)
+
+	_, err = DoTransaction(db.Client())(ctx, func(sessCtx context.Context) (interface{}, error) {
+		return repo.InsertOne(sessCtx, &TestInvoice{})
+	})
+	require.NoError(t, err)
+	count, err := repo.Count(ctx, bson.M{"number": 4})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
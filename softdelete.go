@@ -0,0 +1,189 @@
+package modm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SoftDeleteField is a mixin that enables soft deletes. Embed it next to DefaultField:
+//
+//	type User struct {
+//		modm.DefaultField    `bson:",inline"`
+//		modm.SoftDeleteField `bson:",inline"`
+//		Name                 string `bson:"name,omitempty" json:"name"`
+//	}
+//
+// Deletes of a Repo whose documents embed SoftDeleteField set deleted_at instead of removing the
+// documents, and queries exclude soft-deleted documents unless the context is created with
+// WithTrashed or OnlyTrashed. DeletedAt is stored as null for live documents, so that
+// SoftDeleteUniqueIndex can reference it in a partial filter. Updates with a document leave
+// deleted_at unchanged; only Restore restores a document.
+type SoftDeleteField struct {
+	DeletedAt *time.Time `bson:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// IsDeleted reports whether the document has been soft-deleted.
+func (sf *SoftDeleteField) IsDeleted() bool {
+	return sf.DeletedAt != nil
+}
+
+func (sf *SoftDeleteField) softDeleteField() *SoftDeleteField {
+	return sf
+}
+
+// softDeletable is implemented by documents that embed SoftDeleteField.
+type softDeletable interface {
+	softDeleteField() *SoftDeleteField
+}
+
+type trashedMode int
+
+const (
+	withoutTrashed trashedMode = iota
+	withTrashed
+	onlyTrashed
+)
+
+// WithTrashed returns a context that makes queries include soft-deleted documents.
+func WithTrashed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyTrashed, withTrashed)
+}
+
+// OnlyTrashed returns a context that makes queries match only soft-deleted documents.
+func OnlyTrashed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyTrashed, onlyTrashed)
+}
+
+func trashedModeOf(ctx context.Context) trashedMode {
+	mode, _ := ctx.Value(ctxKeyTrashed).(trashedMode)
+	return mode
+}
+
+// scope restricts filter to live documents, or according to WithTrashed/OnlyTrashed,
+// if the documents of the repository are soft-deletable.
+func (r *Repo[T]) scope(ctx context.Context, filter interface{}) interface{} {
+	if !r.softDelete {
+		return filter
+	}
+	var cond bson.M
+	switch trashedModeOf(ctx) {
+	case withTrashed:
+		return filter
+	case onlyTrashed:
+		cond = bson.M{"deleted_at": bson.M{"$ne": nil}}
+	default:
+		cond = bson.M{"deleted_at": nil}
+	}
+	if filter == nil {
+		return cond
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, cond}}}
+}
+
+// softDeleting reports whether a delete operation should set deleted_at instead of removing documents.
+func (r *Repo[T]) softDeleting(ctx context.Context) bool {
+	return r.softDelete && !ctxFlag(ctx, ctxKeyForceDelete)
+}
+
+// softDeleteUpdate returns the update that marks documents as deleted.
+func softDeleteUpdate() bson.M {
+	return bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+}
+
+// Restore clears deleted_at of the soft-deleted documents that match the filter.
+func (r *Repo[T]) Restore(ctx context.Context, filter interface{}, opts ...*options.UpdateOptions) (restoredCount int64, err error) {
+	return r.UpdateMany(OnlyTrashed(ctx), filter, bson.M{"$set": bson.M{"deleted_at": nil}}, opts...)
+}
+
+// ForceDelete permanently removes the documents that match the filter, including soft-deleted ones.
+// Hooks: BeforeDelete, AfterDelete
+func (r *Repo[T]) ForceDelete(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (deletedCount int64, err error) {
+	ctx = context.WithValue(ctx, ctxKeyForceDelete, true)
+	if trashedModeOf(ctx) == withoutTrashed {
+		ctx = WithTrashed(ctx)
+	}
+	return r.DeleteMany(ctx, filter, opts...)
+}
+
+// SoftDeleteUniqueIndex returns a unique index model, in the format of IndexesToModel, that
+// only applies to documents which have not been soft-deleted.
+// A partial filter cannot match a missing field, so documents without a deleted_at field (e.g.
+// written before SoftDeleteField was embedded) are not covered by the index, although queries
+// treat them as live. Backfill the field before creating the index:
+//
+//	db.Users.Collection().UpdateMany(ctx, bson.M{"deleted_at": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"deleted_at": nil}})
+func SoftDeleteUniqueIndex(index string) mongo.IndexModel {
+	var keys bson.D
+	for _, field := range strings.Split(index, ",") {
+		key, sort := SplitSortField(field)
+		keys = append(keys, primitive.E{Key: key, Value: sort})
+	}
+	return mongo.IndexModel{
+		Keys: keys,
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$type": "null"}}),
+	}
+}
+
+// deleteToUpdateOptions converts the options of a delete into the options of the update that soft-deletes.
+func deleteToUpdateOptions(opts []*options.DeleteOptions) *options.UpdateOptions {
+	uo := options.Update()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Collation != nil {
+			uo.SetCollation(opt.Collation)
+		}
+		if opt.Hint != nil {
+			uo.SetHint(opt.Hint)
+		}
+		if opt.Let != nil {
+			uo.SetLet(opt.Let)
+		}
+		if opt.Comment != nil {
+			uo.SetComment(opt.Comment)
+		}
+	}
+	return uo
+}
+
+// findOneAndDeleteToUpdateOptions converts the options of a FindOneAndDelete into the options of
+// the FindOneAndUpdate that soft-deletes.
+func findOneAndDeleteToUpdateOptions(opts []*options.FindOneAndDeleteOptions) *options.FindOneAndUpdateOptions {
+	uo := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Collation != nil {
+			uo.SetCollation(opt.Collation)
+		}
+		if opt.Hint != nil {
+			uo.SetHint(opt.Hint)
+		}
+		if opt.Let != nil {
+			uo.SetLet(opt.Let)
+		}
+		if opt.Comment != nil {
+			uo.SetComment(opt.Comment)
+		}
+		if opt.MaxTime != nil {
+			uo.SetMaxTime(*opt.MaxTime)
+		}
+		if opt.Projection != nil {
+			uo.SetProjection(opt.Projection)
+		}
+		if opt.Sort != nil {
+			uo.SetSort(opt.Sort)
+		}
+	}
+	return uo
+}
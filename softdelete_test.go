@@ -0,0 +1,126 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TestSoftUser struct {
+	DefaultField    `bson:",inline"`
+	SoftDeleteField `bson:",inline"`
+	Name            string `bson:"name,omitempty" json:"name"`
+	Age             uint   `bson:"age,omitempty" json:"age"`
+}
+
+func TestRepo_scope(t *testing.T) {
+	ctx := context.TODO()
+	filter := bson.M{"name": "go"}
+
+	repo := NewRepo[*TestUser](nil)
+	assert.Equal(t, filter, repo.scope(ctx, filter))
+
+	softRepo := NewRepo[*TestSoftUser](nil)
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{filter, bson.M{"deleted_at": nil}}}}, softRepo.scope(ctx, filter))
+	assert.Equal(t, filter, softRepo.scope(WithTrashed(ctx), filter))
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{filter, bson.M{"deleted_at": bson.M{"$ne": nil}}}}}, softRepo.scope(OnlyTrashed(ctx), filter))
+}
+
+func TestSoftDeleteUniqueIndex(t *testing.T) {
+	model := SoftDeleteUniqueIndex("name,-age")
+	assert.Equal(t, bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(-1)}}, model.Keys)
+	assert.True(t, *model.Options.Unique)
+	assert.Equal(t, bson.M{"deleted_at": bson.M{"$type": "null"}}, model.Options.PartialFilterExpression)
+}
+
+func TestRepo_documentSet(t *testing.T) {
+	update, err := NewRepo[*TestUser](nil).documentSet(&TestUser{Name: "go"})
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"$set": &TestUser{Name: "go"}}, update)
+
+	update, err = NewRepo[*TestSoftUser](nil).documentSet(&TestSoftUser{Name: "go"})
+	require.NoError(t, err)
+	set := update.(bson.D)[0].Value.(bson.D)
+	keys := make([]string, 0, len(set))
+	for _, elem := range set {
+		keys = append(keys, elem.Key)
+	}
+	assert.Contains(t, keys, "name")
+	assert.NotContains(t, keys, "deleted_at")
+}
+
+func TestRepo_SoftDelete(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestSoftUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	err := repo.EnsureIndexes(ctx, nil, nil, SoftDeleteUniqueIndex("name"))
+	require.NoError(t, err)
+	err = repo.InsertMany(ctx, []*TestSoftUser{{Name: "go", Age: 2}, {Name: "goo", Age: 3}, {Name: "gooo", Age: 4}})
+	require.NoError(t, err)
+
+	deletedCount, err := repo.DeleteOne(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deletedCount)
+
+	// The document is kept, but hidden from queries.
+	total, err := db.Collection(testColl).CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	count, err := repo.Count(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	_, err = repo.FindOne(ctx, bson.M{"name": "go"})
+	require.Error(t, err)
+	names, err := repo.Distinct(ctx, "name", bson.M{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []interface{}{"goo", "gooo"}, names)
+	modifiedCount, err := repo.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"age": 10}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), modifiedCount)
+
+	trashed, err := repo.Find(OnlyTrashed(ctx), bson.M{})
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	assert.True(t, trashed[0].IsDeleted())
+	all, err := repo.Find(WithTrashed(ctx), bson.M{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	// Updates with a document leave trashed documents trashed.
+	modifiedCount, err = repo.UpdateOne(WithTrashed(ctx), bson.M{"name": "go"}, &TestSoftUser{Age: 7})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), modifiedCount)
+	trashed, err = repo.Find(OnlyTrashed(ctx), bson.M{"name": "go"})
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	assert.Equal(t, uint(7), trashed[0].Age)
+
+	// Uniques ignore soft-deleted documents.
+	_, err = repo.InsertOne(ctx, &TestSoftUser{Name: "go", Age: 5})
+	require.NoError(t, err)
+	_, err = repo.ForceDelete(ctx, bson.M{"name": "go", "age": 5})
+	require.NoError(t, err)
+
+	restoredCount, err := repo.Restore(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), restoredCount)
+	user, err := repo.FindOne(ctx, bson.M{"name": "go"})
+	require.NoError(t, err)
+	assert.False(t, user.IsDeleted())
+
+	doc, err := repo.FindOneAndDelete(ctx, bson.M{"name": "goo"})
+	require.NoError(t, err)
+	assert.True(t, doc.IsDeleted())
+
+	deletedCount, err = repo.ForceDelete(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deletedCount)
+	total, err = db.Collection(testColl).CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
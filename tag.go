@@ -0,0 +1,66 @@
+package modm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// modmTag is a parsed `modm:"..."` struct tag: a comma-separated list of options, each a flag
+// ("unique") or a key=value pair ("seq=orders"). A numeric segment continues the value of the
+// previous option, so that `modm:"index=name_age,-1"` is a single option.
+type modmTag []tagOption
+
+type tagOption struct {
+	Key   string
+	Value string
+}
+
+func parseModmTag(tag string) modmTag {
+	if tag == "" || tag == "-" {
+		return nil
+	}
+	var t modmTag
+	for _, segment := range strings.Split(tag, ",") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(segment); err == nil && len(t) > 0 {
+			t[len(t)-1].Value += "," + segment
+			continue
+		}
+		key, value := segment, ""
+		if i := strings.IndexByte(segment, '='); i >= 0 {
+			key, value = segment[:i], segment[i+1:]
+		}
+		t = append(t, tagOption{Key: key, Value: value})
+	}
+	return t
+}
+
+// Has reports whether the tag has the option key.
+func (t modmTag) Has(key string) bool {
+	_, ok := t.Lookup(key)
+	return ok
+}
+
+// Lookup returns the value of the first option key.
+func (t modmTag) Lookup(key string) (string, bool) {
+	for _, opt := range t {
+		if opt.Key == key {
+			return opt.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the values of all the options key.
+func (t modmTag) Values(key string) []string {
+	var values []string
+	for _, opt := range t {
+		if opt.Key == key {
+			values = append(values, opt.Value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,28 @@
+package modm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModmTag(t *testing.T) {
+	tag := parseModmTag("index=name_age,-1, unique,seq=orders,enum=a|b,index")
+	assert.Equal(t, modmTag{
+		{Key: "index", Value: "name_age,-1"},
+		{Key: "unique"},
+		{Key: "seq", Value: "orders"},
+		{Key: "enum", Value: "a|b"},
+		{Key: "index"},
+	}, tag)
+	assert.True(t, tag.Has("unique"))
+	assert.False(t, tag.Has("sparse"))
+	v, ok := tag.Lookup("seq")
+	assert.True(t, ok)
+	assert.Equal(t, "orders", v)
+	assert.Equal(t, []string{"name_age,-1", ""}, tag.Values("index"))
+
+	assert.Nil(t, parseModmTag(""))
+	assert.Nil(t, parseModmTag("-"))
+	assert.Equal(t, modmTag{{Key: "2dsphere"}}, parseModmTag("2dsphere"))
+}
@@ -0,0 +1,420 @@
+package modm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Update is an update document builder bound to the document type T.
+// Fields are given as in Filter, and values are checked against the Go types of the fields:
+//
+//	u := modm.Model[*User]()
+//	update := modm.NewUpdate[*User]().Set(&u.Name, "gooooo").Inc(&u.Age, 1).Push(&u.Tags, "go")
+//	modifiedCount, err := db.Users.UpdateOne(ctx, filter, update)
+//
+// When an Update is passed to UpdateOne, UpdateMany, UpdateByID or FindOneAndUpdate, the fields set
+// by the BeforeUpdate hook of T (e.g. updated_at of DefaultField) are added to $set, and the array
+// filters are added to the options.
+type Update[T Document] struct {
+	ops          []updateOperator
+	arrayFilters []interface{}
+	err          error
+}
+
+type updateOperator struct {
+	name   string
+	fields bson.D
+}
+
+// NewUpdate starts an update for documents of type T.
+func NewUpdate[T Document]() *Update[T] {
+	return &Update[T]{}
+}
+
+func (u *Update[T]) add(op string, field interface{}, value interface{}, check func(path string, t reflect.Type) error) *Update[T] {
+	if u.err != nil {
+		return u
+	}
+	path, t, err := resolveField[T](field)
+	if err == nil && check != nil {
+		err = check(path, t)
+	}
+	if err != nil {
+		u.err = err
+		return u
+	}
+	for i := range u.ops {
+		if u.ops[i].name == op {
+			u.ops[i].fields = append(u.ops[i].fields, bson.E{Key: path, Value: value})
+			return u
+		}
+	}
+	u.ops = append(u.ops, updateOperator{name: op, fields: bson.D{{Key: path, Value: value}}})
+	return u
+}
+
+// Set sets the value of a field ($set).
+func (u *Update[T]) Set(field interface{}, value interface{}) *Update[T] {
+	return u.add("$set", field, value, valueCheck(value))
+}
+
+// SetOnInsert sets the value of a field if the update results in an insert ($setOnInsert).
+func (u *Update[T]) SetOnInsert(field interface{}, value interface{}) *Update[T] {
+	return u.add("$setOnInsert", field, value, valueCheck(value))
+}
+
+// Unset removes a field ($unset).
+func (u *Update[T]) Unset(field interface{}) *Update[T] {
+	return u.add("$unset", field, "", nil)
+}
+
+// Inc increments a numeric field by n ($inc).
+func (u *Update[T]) Inc(field interface{}, n interface{}) *Update[T] {
+	return u.add("$inc", field, n, numericCheck(n))
+}
+
+// Mul multiplies a numeric field by n ($mul).
+func (u *Update[T]) Mul(field interface{}, n interface{}) *Update[T] {
+	return u.add("$mul", field, n, numericCheck(n))
+}
+
+// Min updates a field if value is less than its current value ($min).
+func (u *Update[T]) Min(field interface{}, value interface{}) *Update[T] {
+	return u.add("$min", field, value, valueCheck(value))
+}
+
+// Max updates a field if value is greater than its current value ($max).
+func (u *Update[T]) Max(field interface{}, value interface{}) *Update[T] {
+	return u.add("$max", field, value, valueCheck(value))
+}
+
+// CurrentDate sets a date field to the current date ($currentDate).
+func (u *Update[T]) CurrentDate(field interface{}) *Update[T] {
+	return u.add("$currentDate", field, true, func(path string, t reflect.Type) error {
+		switch indirectType(t) {
+		case reflect.TypeOf(time.Time{}), reflect.TypeOf(primitive.DateTime(0)), reflect.TypeOf(primitive.Timestamp{}):
+			return nil
+		}
+		if t.Kind() == reflect.Interface {
+			return nil
+		}
+		return fmt.Errorf("modm: $currentDate requires a date field, %q is %s", path, t)
+	})
+}
+
+// Rename renames a field ($rename).
+func (u *Update[T]) Rename(field interface{}, newName string) *Update[T] {
+	return u.add("$rename", field, newName, nil)
+}
+
+// Push appends values to an array field ($push, with $each for several values).
+func (u *Update[T]) Push(field interface{}, values ...interface{}) *Update[T] {
+	return u.add("$push", field, eachValue(values), elemCheck(values))
+}
+
+// AddToSet adds values to an array field unless they are already present ($addToSet, with $each for several values).
+func (u *Update[T]) AddToSet(field interface{}, values ...interface{}) *Update[T] {
+	return u.add("$addToSet", field, eachValue(values), elemCheck(values))
+}
+
+// Pull removes the array elements that match the value or condition ($pull).
+func (u *Update[T]) Pull(field interface{}, valueOrCondition interface{}) *Update[T] {
+	return u.add("$pull", field, valueOrCondition, elemCheck(nil))
+}
+
+// PullAll removes all instances of the values from an array field ($pullAll).
+func (u *Update[T]) PullAll(field interface{}, values ...interface{}) *Update[T] {
+	return u.add("$pullAll", field, bson.A(values), elemCheck(values))
+}
+
+// Pop removes the first (first is true) or last element of an array field ($pop).
+func (u *Update[T]) Pop(field interface{}, first bool) *Update[T] {
+	n := 1
+	if first {
+		n = -1
+	}
+	return u.add("$pop", field, n, elemCheck(nil))
+}
+
+// ArrayFilter adds a filter for the $[identifier] positional operator, e.g. bson.M{"elem.qty": bson.M{"$gt": 5}}.
+func (u *Update[T]) ArrayFilter(filter interface{}) *Update[T] {
+	u.arrayFilters = append(u.arrayFilters, filter)
+	return u
+}
+
+// ArrayFilters returns the array filters of the update.
+func (u *Update[T]) ArrayFilters() []interface{} {
+	return u.arrayFilters
+}
+
+// Err returns the first error recorded while building the update.
+func (u *Update[T]) Err() error {
+	return u.err
+}
+
+// Build returns the update document, or the first error recorded while building it.
+func (u *Update[T]) Build() (bson.D, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	if len(u.ops) == 0 {
+		return nil, fmt.Errorf("modm: empty update")
+	}
+	d := make(bson.D, 0, len(u.ops))
+	for _, op := range u.ops {
+		d = append(d, bson.E{Key: op.name, Value: op.fields})
+	}
+	return d, nil
+}
+
+// MarshalBSON implements bson.Marshaler, so that an Update can be used as an update document.
+func (u *Update[T]) MarshalBSON() ([]byte, error) {
+	d, err := u.Build()
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(d)
+}
+
+// Pipeline renders the update as an aggregation pipeline update. Only $set, $unset, $inc, $mul,
+// $min, $max and $currentDate can be expressed as a pipeline. As for an Update, the fields set by
+// the BeforeUpdate hook of T are added in a final $set stage.
+func (u *Update[T]) Pipeline(ctx context.Context) (mongo.Pipeline, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	set := bson.D{}
+	var unset bson.A
+	for _, op := range u.ops {
+		for _, field := range op.fields {
+			ref := "$" + field.Key
+			switch op.name {
+			case "$set":
+				set = append(set, bson.E{Key: field.Key, Value: bson.D{{Key: "$literal", Value: field.Value}}})
+			case "$unset":
+				unset = append(unset, field.Key)
+			case "$inc":
+				set = append(set, bson.E{Key: field.Key, Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{ref, 0}}}, field.Value}}}})
+			case "$mul":
+				set = append(set, bson.E{Key: field.Key, Value: bson.D{{Key: "$multiply", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{ref, 0}}}, field.Value}}}})
+			case "$min", "$max":
+				set = append(set, bson.E{Key: field.Key, Value: bson.D{{Key: op.name, Value: bson.A{ref, field.Value}}}})
+			case "$currentDate":
+				set = append(set, bson.E{Key: field.Key, Value: "$$NOW"})
+			default:
+				return nil, fmt.Errorf("modm: %s cannot be expressed as a pipeline update", op.name)
+			}
+		}
+	}
+	var pipeline mongo.Pipeline
+	if len(set) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: set}})
+	}
+	if len(unset) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	}
+	hooked, err := beforeUpdateFields[T](ctx)
+	if err != nil {
+		return nil, err
+	}
+	var extra bson.D
+	for _, field := range hooked {
+		if !u.targets(field.Key) {
+			extra = append(extra, bson.E{Key: field.Key, Value: bson.D{{Key: "$literal", Value: field.Value}}})
+		}
+	}
+	if len(extra) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: extra}})
+	}
+	return pipeline, nil
+}
+
+// render validates the $set values (see Validate) and returns the update document with the
+// fields set by the BeforeUpdate hook of T added to $set, and an increment of the version if T
+// embeds VersionField. Fields already targeted by an operator are left untouched.
+func (u *Update[T]) render(ctx context.Context) (bson.D, error) {
+	d, err := u.Build()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range u.ops {
+		if op.name == "$set" {
+			if err := validateSet[T](op.fields); err != nil {
+				return nil, err
+			}
+		}
+	}
+	hooked, err := beforeUpdateFields[T](ctx)
+	if err != nil {
+		return nil, err
+	}
+	var extra bson.D
+	for _, field := range hooked {
+		if !u.targets(field.Key) {
+			extra = append(extra, field)
+		}
+	}
+	d = withOperatorFields(d, "$set", extra)
+	if _, ok := interface{}(newDocument[T]()).(versioned); ok && !u.targets("version") {
+		d = withOperatorFields(d, "$inc", bson.D{{Key: "version", Value: int64(1)}})
+	}
+	return d, nil
+}
+
+// withOperatorFields returns d with fields added to the operator op.
+func withOperatorFields(d bson.D, op string, fields bson.D) bson.D {
+	if len(fields) == 0 {
+		return d
+	}
+	for i := range d {
+		if d[i].Key == op {
+			d[i].Value = append(append(bson.D{}, d[i].Value.(bson.D)...), fields...)
+			return d
+		}
+	}
+	return append(d, bson.E{Key: op, Value: fields})
+}
+
+// targets reports whether an operator of the update targets path, a parent or a child of it.
+func (u *Update[T]) targets(path string) bool {
+	for _, op := range u.ops {
+		for _, field := range op.fields {
+			if field.Key == path || strings.HasPrefix(field.Key, path+".") || strings.HasPrefix(path, field.Key+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// beforeUpdateFields returns the top-level fields that the BeforeUpdate hook of T sets on a zero document.
+func beforeUpdateFields[T Document](ctx context.Context) (bson.D, error) {
+	zero, err := bson.Marshal(newDocument[T]())
+	if err != nil {
+		return nil, err
+	}
+	doc := newDocument[T]()
+	doc.BeforeUpdate(ctx)
+	hooked, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := bson.Raw(hooked).Elements()
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.D
+	for _, elem := range elems {
+		before, err := bson.Raw(zero).LookupErr(elem.Key())
+		if err == nil && before.Type == elem.Value().Type && bytes.Equal(before.Value, elem.Value().Value) {
+			continue
+		}
+		fields = append(fields, bson.E{Key: elem.Key(), Value: elem.Value()})
+	}
+	return fields, nil
+}
+
+// eachValue returns the value of $push/$addToSet for one or several values.
+func eachValue(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return bson.D{{Key: "$each", Value: bson.A(values)}}
+}
+
+// valueCheck returns a check that value can be stored in a field.
+func valueCheck(value interface{}) func(path string, t reflect.Type) error {
+	return func(path string, t reflect.Type) error {
+		if !compatibleValue(t, value) {
+			return fmt.Errorf("modm: cannot use %T as %s for field %q", value, t, path)
+		}
+		return nil
+	}
+}
+
+// numericCheck returns a check that a field and n are numeric.
+func numericCheck(n interface{}) func(path string, t reflect.Type) error {
+	return func(path string, t reflect.Type) error {
+		if n == nil || !isNumericKind(reflect.TypeOf(n).Kind()) {
+			return fmt.Errorf("modm: %T is not a number for field %q", n, path)
+		}
+		if t.Kind() != reflect.Interface && !isNumericKind(indirectType(t).Kind()) {
+			return fmt.Errorf("modm: field %q is %s, not a number", path, t)
+		}
+		return nil
+	}
+}
+
+// elemCheck returns a check that a field is an array that can hold values.
+func elemCheck(values []interface{}) func(path string, t reflect.Type) error {
+	return func(path string, t reflect.Type) error {
+		if t.Kind() == reflect.Interface {
+			return nil
+		}
+		t = indirectType(t)
+		if !isArrayType(t) {
+			return fmt.Errorf("modm: field %q is %s, not an array", path, t)
+		}
+		for _, value := range values {
+			if !compatibleValue(t.Elem(), value) {
+				return fmt.Errorf("modm: cannot use %T as element %s of field %q", value, t.Elem(), path)
+			}
+		}
+		return nil
+	}
+}
+
+// compatibleValue reports whether value can be stored in a field of type t. Numbers are compatible
+// with each other, and documents (bson.M, bson.D, ...) with structs and maps.
+func compatibleValue(t reflect.Type, value interface{}) bool {
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			return true
+		}
+		return false
+	}
+	vt := reflect.TypeOf(value)
+	if vt.AssignableTo(t) {
+		return true
+	}
+	t = indirectType(t)
+	vt = indirectType(vt)
+	if vt.AssignableTo(t) {
+		return true
+	}
+	switch {
+	case isNumericKind(t.Kind()):
+		return isNumericKind(vt.Kind())
+	case t.Kind() == reflect.String:
+		return vt.Kind() == reflect.String
+	case t == reflect.TypeOf(time.Time{}):
+		return vt == reflect.TypeOf(primitive.DateTime(0))
+	case t.Kind() == reflect.Struct || t.Kind() == reflect.Map:
+		return vt.Kind() == reflect.Map || vt == reflect.TypeOf(bson.D{}) || vt == reflect.TypeOf(bson.Raw{})
+	case isArrayType(t):
+		return isArrayType(vt)
+	}
+	return false
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
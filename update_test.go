@@ -0,0 +1,132 @@
+package modm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUpdate(t *testing.T) {
+	u := Model[*TestProfile]()
+	update, err := NewUpdate[*TestProfile]().
+		Set(&u.Name, "go").
+		Set(&u.Address.City, "Berlin").
+		Inc(&u.Age, 1).
+		Unset(&u.Nickname).
+		Push(&u.Tags, "a", "b").
+		AddToSet(&u.Tags, "c").
+		Max(&u.Score, 10).
+		CurrentDate(&u.UpdatedAt).
+		Set("addresses.$[elem].zip", "10115").
+		ArrayFilter(bson.M{"elem.city": "Berlin"}).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: "go"}, {Key: "address.city", Value: "Berlin"}, {Key: "addresses.$[elem].zip", Value: "10115"}}},
+		{Key: "$inc", Value: bson.D{{Key: "age", Value: 1}}},
+		{Key: "$unset", Value: bson.D{{Key: "nickname", Value: ""}}},
+		{Key: "$push", Value: bson.D{{Key: "tags", Value: bson.D{{Key: "$each", Value: bson.A{"a", "b"}}}}}},
+		{Key: "$addToSet", Value: bson.D{{Key: "tags", Value: "c"}}},
+		{Key: "$max", Value: bson.D{{Key: "score", Value: 10}}},
+		{Key: "$currentDate", Value: bson.D{{Key: "updated_at", Value: true}}},
+	}, update)
+}
+
+func TestUpdate_Error(t *testing.T) {
+	u := Model[*TestProfile]()
+	tests := []*Update[*TestProfile]{
+		NewUpdate[*TestProfile](),
+		NewUpdate[*TestProfile]().Set("unknown", 1),
+		NewUpdate[*TestProfile]().Set(&u.Age, "old"),
+		NewUpdate[*TestProfile]().Set(&u.Name, nil),
+		NewUpdate[*TestProfile]().Inc(&u.Name, 1),
+		NewUpdate[*TestProfile]().Inc(&u.Age, "1"),
+		NewUpdate[*TestProfile]().Push(&u.Name, "go"),
+		NewUpdate[*TestProfile]().Push(&u.Tags, 1),
+		NewUpdate[*TestProfile]().CurrentDate(&u.Name),
+	}
+	for i, update := range tests {
+		_, err := update.Build()
+		assert.Error(t, err, i)
+	}
+	ok := NewUpdate[*TestProfile]().Set(&u.Nickname, nil).Set(&u.Address, bson.M{"city": "Paris"}).Set(&u.Score, 1)
+	assert.NoError(t, ok.Err())
+}
+
+func TestUpdate_Pipeline(t *testing.T) {
+	u := Model[*TestProfile]()
+	pipeline, err := NewUpdate[*TestProfile]().Set(&u.Name, "go").Inc(&u.Age, 1).Unset(&u.Tags).Pipeline(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, pipeline, 3)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "name", Value: bson.D{{Key: "$literal", Value: "go"}}},
+			{Key: "age", Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$age", 0}}}, 1}}}},
+		}}},
+		{{Key: "$unset", Value: bson.A{"tags"}}},
+	}, pipeline[:2])
+	// The fields of the BeforeUpdate hook are set in a final stage.
+	set := pipeline[2][0].Value.(bson.D)
+	require.Len(t, set, 1)
+	assert.Equal(t, "updated_at", set[0].Key)
+
+	pipeline, err = NewUpdate[*TestProfile]().CurrentDate(&u.UpdatedAt).Pipeline(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: "$$NOW"}}}}}, pipeline)
+
+	_, err = NewUpdate[*TestProfile]().Push(&u.Tags, "go").Pipeline(context.TODO())
+	assert.Error(t, err)
+}
+
+func TestUpdate_render(t *testing.T) {
+	u := Model[*TestProfile]()
+	update, err := NewUpdate[*TestProfile]().Inc(&u.Age, 1).render(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, update, 2)
+	assert.Equal(t, "$set", update[1].Key)
+	set := update[1].Value.(bson.D)
+	require.Len(t, set, 1)
+	assert.Equal(t, "updated_at", set[0].Key)
+
+	// Fields targeted explicitly are not overwritten.
+	update, err = NewUpdate[*TestProfile]().CurrentDate(&u.UpdatedAt).render(context.TODO())
+	require.NoError(t, err)
+	assert.Len(t, update, 1)
+}
+
+func TestRepo_UpdateByBuilder(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestProfile](db.Collection(testColl))
+
+	ctx := context.TODO()
+	profile, err := repo.InsertOne(ctx, &TestProfile{
+		Name:      "go",
+		Age:       2,
+		Addresses: []*TestAddress{{City: "Berlin"}, {City: "Paris"}},
+	})
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	u := Model[*TestProfile]()
+	modifiedCount, err := repo.UpdateByID(ctx, profile.ID, NewUpdate[*TestProfile]().
+		Inc(&u.Age, 1).
+		Push(&u.Tags, "a", "b").
+		Set("addresses.$[elem].zip", "10115").
+		ArrayFilter(bson.M{"elem.city": "Berlin"}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), modifiedCount)
+
+	updated, err := repo.FindOneAndUpdate(ctx, bson.M{"_id": profile.ID}, NewUpdate[*TestProfile]().Set(&u.Age, 0))
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), updated.Age)
+	assert.Equal(t, []string{"a", "b"}, updated.Tags)
+	assert.Equal(t, "10115", updated.Addresses[0].Zip)
+	assert.Equal(t, "", updated.Addresses[1].Zip)
+	assert.True(t, updated.UpdatedAt.After(profile.UpdatedAt))
+}
@@ -1,10 +1,10 @@
 package modm
 
 import (
+	"errors"
 	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -29,14 +29,10 @@ func GetPointer[T any](value T) *T {
 //	    return fmt.Errorf("Document not found")
 //	}
 func IsDocumentExists(err error) (bool, error) {
-	// if err == mongo.ErrNoDocuments {
-	// 	err = nil
-	// }
-	// return err == nil, err
 	if err == nil {
 		return true, nil
 	}
-	if err == mongo.ErrNoDocuments {
+	if errors.Is(err, ErrNotFound) {
 		return false, nil
 	}
 	return false, err
@@ -45,37 +41,39 @@ func IsDocumentExists(err error) (bool, error) {
 // Generate index models from unique and compound index definitions.
 // If uniques/indexes is []string{"name"}, means create index "name"
 // If uniques/indexes is []string{"name,-age","uid"}, means create compound indexes: name and -age, then create one index: uid
+// The definitions are only split into keys, as before the syntax of ParseIndex: flags and options
+// are not supported, and any field name is accepted.
+//
+// Deprecated: Use ParseIndexes, which supports the syntax of ParseIndex and returns the syntax errors.
 func IndexesToModel(uniques []string, indexes []string) []mongo.IndexModel {
 	var indexesModel []mongo.IndexModel
 
 	for _, index := range uniques {
-		var keys bson.D
-		vv := strings.Split(index, ",")
-		for _, field := range vv {
-			key, sort := SplitSortField(field)
-			keys = append(keys, primitive.E{key, sort})
-		}
 		indexesModel = append(indexesModel, mongo.IndexModel{
-			Keys:    keys,
+			Keys:    splitIndexKeys(index),
 			Options: options.Index().SetUnique(true),
 		})
 	}
 
 	for _, index := range indexes {
-		var keys bson.D
-		vv := strings.Split(index, ",")
-		for _, field := range vv {
-			key, sort := SplitSortField(field)
-			keys = append(keys, primitive.E{key, sort})
-		}
 		indexesModel = append(indexesModel, mongo.IndexModel{
-			Keys: keys,
+			Keys: splitIndexKeys(index),
 		})
 	}
 
 	return indexesModel
 }
 
+// splitIndexKeys returns the keys of a comma-separated index definition.
+func splitIndexKeys(index string) bson.D {
+	var keys bson.D
+	for _, field := range strings.Split(index, ",") {
+		key, sort := SplitSortField(field)
+		keys = append(keys, bson.E{Key: key, Value: sort})
+	}
+	return keys
+}
+
 // SplitSortField handle sort symbol: "+"/"-" in front of field.
 // if "+", return sort as 1
 // if "-", return sort as -1
@@ -0,0 +1,402 @@
+package modm
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FieldError is a field that failed validation.
+type FieldError struct {
+	// Path is the bson path of the field, e.g. "addresses.0.city".
+	Path string
+	// Rule is the failed rule, e.g. "required", "max" or the name of a custom validator.
+	Rule    string
+	Message string
+}
+
+func (e FieldError) String() string {
+	return e.Path + " " + e.Message
+}
+
+// ValidationError is returned by the writes of documents that fail validation (see Validate).
+type ValidationError struct {
+	// Index is the position of the invalid document in InsertMany.
+	Index  int
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, f := range e.Errors {
+		msgs[i] = f.String()
+	}
+	return "modm: invalid document: " + strings.Join(msgs, "; ")
+}
+
+// ValidatorFunc checks the value of a field. param is the value of the tag option, e.g. "ab"
+// for `modm:"prefix=ab"`. The message of the returned error is reported in the FieldError.
+type ValidatorFunc func(value interface{}, param string) error
+
+var validators sync.Map // map[string]ValidatorFunc
+
+// RegisterValidator registers a custom validator for the modm tag option name, e.g.
+// `modm:"slug"` or `modm:"prefix=ab"`. It panics if name is a built-in option.
+// Validators must be registered (e.g. in init) before the types that use them are validated.
+func RegisterValidator(name string, fn ValidatorFunc) {
+	switch name {
+	case "required", "min", "max", "len", "regex", "enum", "email":
+		panic("modm: RegisterValidator of built-in rule " + name)
+	}
+	if nonRuleOptions[name] {
+		panic("modm: RegisterValidator of tag option " + name)
+	}
+	validators.Store(name, fn)
+}
+
+// fieldCheck is a field of a struct with validation rules.
+type fieldCheck struct {
+	field *structField
+	rules fieldRules
+	// nested is true if the field holds documents to validate, e.g. a struct or a slice of structs.
+	nested bool
+}
+
+type structChecks struct {
+	checks []fieldCheck
+	err    error
+}
+
+var structChecksCache sync.Map // map[reflect.Type]*structChecks
+
+func getStructChecks(t reflect.Type) ([]fieldCheck, error) {
+	if c, ok := structChecksCache.Load(t); ok {
+		c := c.(*structChecks)
+		return c.checks, c.err
+	}
+	c := &structChecks{}
+	for _, f := range getStructInfo(t).Fields {
+		rules, err := parseFieldRules(f.Name, f.Type, f.Modm)
+		if err != nil {
+			c.err = err
+			break
+		}
+		c.checks = append(c.checks, fieldCheck{field: f, rules: rules, nested: holdsDocuments(f.Type)})
+	}
+	actual, _ := structChecksCache.LoadOrStore(t, c)
+	c = actual.(*structChecks)
+	return c.checks, c.err
+}
+
+// holdsDocuments reports whether values of type t contain structs to validate.
+func holdsDocuments(t reflect.Type) bool {
+	t = indirectType(t)
+	switch {
+	case t.Kind() == reflect.Struct:
+		return !isAtomicStruct(t)
+	case isArrayType(t) || t.Kind() == reflect.Map:
+		return holdsDocuments(t.Elem())
+	}
+	return false
+}
+
+// Validate checks doc against the rules of the modm tags of its fields (see BSONSchema), and
+// returns a *ValidationError listing every failing field. The rules are:
+//
+//	required   the value is not zero: nil, "", 0, false or the zero time
+//	min, max   bounds of a number, or of the length of a string (in characters), an array or a map
+//	len        exact length of a string, an array or a map
+//	enum=a|b   allowed values, or allowed elements of an array
+//	regex=...  pattern that a string must match
+//	email      a plain email address, e.g. "gopher@example.com"
+//
+// and the custom validators registered with RegisterValidator; other options are reported as an
+// error. Options are separated by commas, so a regex cannot contain one: match a comma with
+// \\x2c in the struct tag (\x2c in the pattern), and write a bounded repetition such as
+// [0-9]{2,3} as [0-9][0-9][0-9]?. Nil pointers, slices and maps are only checked for required.
+// Nested documents are validated too.
+// InsertOne and InsertMany validate the documents after the BeforeInsert hooks, and the updates
+// with a document after the BeforeUpdate hooks, skipping the fields omitted with omitempty.
+func Validate(doc interface{}) error {
+	return validateDocument(doc, false)
+}
+
+func validateDocument(doc interface{}, partial bool) error {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []FieldError
+	if err := validateStruct(v, "", partial, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, partial bool, errs *[]FieldError) error {
+	checks, err := getStructChecks(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, c := range checks {
+		fv, err := v.FieldByIndexErr(c.field.Index)
+		if err != nil {
+			// A nil embedded pointer: the field is not encoded.
+			continue
+		}
+		path := prefix + c.field.Name
+		if fv.IsZero() && c.field.OmitEmpty {
+			if !partial && c.rules.required {
+				*errs = append(*errs, FieldError{Path: path, Rule: "required", Message: "is required"})
+			}
+			continue
+		}
+		if err := validateValue(fv, path, c.rules, errs); err != nil {
+			return err
+		}
+		if c.nested {
+			if err := validateNested(fv, path, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateNested validates the documents held by v: a struct, or the elements of an array or a map.
+func validateNested(v reflect.Value, path string, errs *[]FieldError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return validateStruct(v, path+".", false, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(v.Index(i), path+"."+strconv.Itoa(i), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := validateNested(iter.Value(), path+"."+iter.Key().String(), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateValue checks the value of a field against rules.
+func validateValue(v reflect.Value, path string, rules fieldRules, errs *[]FieldError) error {
+	fail := func(rule, format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Path: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	if rules.required && v.IsZero() {
+		fail("required", "is required")
+		return nil
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if rules.min != nil || rules.max != nil {
+		n, isLen, ok := measure(v)
+		switch {
+		case !ok:
+		case rules.min != nil && rules.max != nil && *rules.min == *rules.max && isLen && n != *rules.min:
+			fail("len", "length must be %v", *rules.min)
+		case rules.min != nil && n < *rules.min && isLen:
+			fail("min", "length must be at least %v", *rules.min)
+		case rules.min != nil && n < *rules.min:
+			fail("min", "must be at least %v", *rules.min)
+		case rules.max != nil && n > *rules.max && isLen:
+			fail("max", "length must be at most %v", *rules.max)
+		case rules.max != nil && n > *rules.max:
+			fail("max", "must be at most %v", *rules.max)
+		}
+	}
+
+	values := []reflect.Value{v}
+	if isArrayType(v.Type()) {
+		values = values[:0]
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, reflect.Indirect(v.Index(i)))
+		}
+	}
+	for _, value := range values {
+		if len(rules.enum) > 0 && !inEnum(value, rules.enum) {
+			fail("enum", "must be one of %v", rules.enum)
+			break
+		}
+	}
+	for _, value := range values {
+		if value.Kind() != reflect.String {
+			continue
+		}
+		s := value.String()
+		if rules.pattern != nil && !rules.pattern.MatchString(s) {
+			fail("regex", "must match %s", rules.pattern)
+			break
+		}
+		if rules.email && !isEmail(s) {
+			fail("email", "must be an email address")
+			break
+		}
+	}
+
+	for _, opt := range rules.custom {
+		// parseFieldRules only keeps the registered validators.
+		fn, _ := validators.Load(opt.Key)
+		if err := fn.(ValidatorFunc)(v.Interface(), opt.Value); err != nil {
+			fail(opt.Key, "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// measure returns the number that min and max apply to: a number, or the length of a string,
+// an array or a map.
+func measure(v reflect.Value) (n float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
+
+// inEnum reports whether v is one of the values of an enum, as parsed by parseEnumValue.
+func inEnum(v reflect.Value, enum []interface{}) bool {
+	var value interface{}
+	switch v.Kind() {
+	case reflect.String:
+		value = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		value = v.Float()
+	case reflect.Bool:
+		value = v.Bool()
+	default:
+		return true
+	}
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// validateSet checks the values of the $set operator of a typed update against the rules of
+// the fields of T.
+func validateSet[T Document](set bson.D) error {
+	docType := documentType[T]()
+	var errs []FieldError
+	for _, e := range set {
+		check, elem, ok := lookupFieldCheck(docType, e.Key)
+		if !ok {
+			continue
+		}
+		v := reflect.ValueOf(e.Value)
+		if !v.IsValid() {
+			if check.rules.required && !elem {
+				errs = append(errs, FieldError{Path: e.Key, Rule: "required", Message: "is required"})
+			}
+			continue
+		}
+		rules := check.rules
+		if elem {
+			// The path addresses an element of an array field: only the element rules apply.
+			rules = fieldRules{enum: rules.enum, pattern: rules.pattern, email: rules.email}
+		}
+		if err := validateValue(v, e.Key, rules, &errs); err != nil {
+			return err
+		}
+		if check.nested {
+			if err := validateNested(v, e.Key, &errs); err != nil {
+				return err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// lookupFieldCheck returns the rules of the field addressed by path, and whether path addresses
+// an element of the field rather than the field itself.
+func lookupFieldCheck(t reflect.Type, path string) (check fieldCheck, elem bool, ok bool) {
+	cur := indirectType(t)
+	for _, segment := range strings.Split(path, ".") {
+		switch {
+		case isArrayType(cur) && isArrayIndex(segment):
+			cur = indirectType(cur.Elem())
+			elem = true
+			continue
+		case isArrayType(cur):
+			cur = indirectType(cur.Elem())
+		case cur.Kind() == reflect.Map:
+			cur = indirectType(cur.Elem())
+			elem = true
+			continue
+		}
+		if cur.Kind() != reflect.Struct {
+			return check, false, false
+		}
+		checks, err := getStructChecks(cur)
+		if err != nil {
+			return check, false, false
+		}
+		found := false
+		for _, c := range checks {
+			if c.field.Name == segment {
+				check, elem, found = c, false, true
+				break
+			}
+		}
+		if !found {
+			return check, false, false
+		}
+		cur = indirectType(check.field.Type)
+	}
+	return check, elem, true
+}
@@ -0,0 +1,190 @@
+package modm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TestValidAddress struct {
+	City    string `bson:"city" modm:"required"`
+	Country string `bson:"country,omitempty" modm:"len=2"`
+}
+
+type TestValidUser struct {
+	DefaultField `bson:",inline"`
+	Name         string             `bson:"name" modm:"required,min=2,max=10"`
+	Email        string             `bson:"email,omitempty" modm:"required,email"`
+	Age          int                `bson:"age,omitempty" modm:"min=0,max=150"`
+	Role         string             `bson:"role,omitempty" modm:"enum=admin|user"`
+	Code         string             `bson:"code,omitempty" modm:"regex=^[A-Z]+$"`
+	Slug         string             `bson:"slug,omitempty" modm:"testslug"`
+	Tags         []string           `bson:"tags,omitempty" modm:"max=2,enum=a|b|c"`
+	Nickname     *string            `bson:"nickname,omitempty" modm:"min=3"`
+	Address      *TestValidAddress  `bson:"address,omitempty"`
+	Addresses    []TestValidAddress `bson:"addresses,omitempty"`
+}
+
+func init() {
+	RegisterValidator("testslug", func(value interface{}, param string) error {
+		if s, _ := value.(string); strings.Contains(s, " ") {
+			return errors.New("must not contain spaces")
+		}
+		return nil
+	})
+}
+
+func validationPaths(t *testing.T, err error) map[string]string {
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "%v", err)
+	paths := map[string]string{}
+	for _, f := range validationErr.Errors {
+		paths[f.Path] = f.Rule
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	valid := &TestValidUser{Name: "Alice", Email: "alice@example.com", Age: 30, Role: "admin", Tags: []string{"a"}}
+	assert.NoError(t, Validate(valid))
+
+	short := "ab"
+	err := Validate(&TestValidUser{
+		Name:      "A",
+		Age:       200,
+		Role:      "root",
+		Code:      "abc",
+		Slug:      "a b",
+		Tags:      []string{"a", "d", "c"},
+		Nickname:  &short,
+		Address:   &TestValidAddress{Country: "FRA"},
+		Addresses: []TestValidAddress{{City: "Paris"}, {}},
+	})
+	assert.Equal(t, map[string]string{
+		"name":             "min",
+		"email":            "required",
+		"age":              "max",
+		"role":             "enum",
+		"code":             "regex",
+		"slug":             "testslug",
+		"tags":             "enum",
+		"nickname":         "min",
+		"address.city":     "required",
+		"address.country":  "len",
+		"addresses.1.city": "required",
+	}, validationPaths(t, err))
+	assert.Contains(t, err.Error(), "modm: invalid document: name length must be at least 2; email is required; age must be at most 150")
+
+	err = Validate(&TestValidUser{Name: "Alice", Email: "Alice <alice@example.com>", Tags: []string{"a", "b", "c"}})
+	assert.Equal(t, map[string]string{"email": "email", "tags": "max"}, validationPaths(t, err))
+}
+
+func TestValidate_partial(t *testing.T) {
+	assert.NoError(t, validateDocument(&TestValidUser{Name: "go", Age: 20}, true))
+	err := validateDocument(&TestValidUser{Name: "go", Age: 200}, true)
+	assert.Equal(t, map[string]string{"age": "max"}, validationPaths(t, err))
+
+	// Zero fields without omitempty are written by the update, so they are validated.
+	err = validateDocument(&TestValidUser{Age: 20}, true)
+	assert.Equal(t, map[string]string{"name": "required"}, validationPaths(t, err))
+	type level struct {
+		DefaultField `bson:",inline"`
+		Level        int `bson:"level" modm:"min=1"`
+	}
+	err = validateDocument(&level{}, true)
+	assert.Equal(t, map[string]string{"level": "min"}, validationPaths(t, err))
+}
+
+func TestValidate_badTag(t *testing.T) {
+	type badRegex struct {
+		DefaultField `bson:",inline"`
+		Code         string `bson:"code" modm:"regex=("`
+	}
+	err := Validate(&badRegex{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `modm: field code: invalid regex "("`)
+
+	type unknownOption struct {
+		DefaultField `bson:",inline"`
+		Name         string `bson:"name" modm:"requried"`
+	}
+	err = Validate(&unknownOption{})
+	assert.EqualError(t, err, `modm: field name: unknown option "requried"`)
+
+	type regexComma struct {
+		DefaultField `bson:",inline"`
+		Code         string `bson:"code" modm:"regex=^[0-9]{2,3}$"`
+	}
+	err = Validate(&regexComma{})
+	assert.EqualError(t, err, `modm: field code: unknown option "3}$" after regex "^[0-9]{2"; regex patterns cannot contain commas`)
+}
+
+func TestValidate_regexComma(t *testing.T) {
+	type pair struct {
+		DefaultField `bson:",inline"`
+		Pair         string `bson:"pair" modm:"regex=^[a-z]+\\x2c[a-z]+$,required"`
+	}
+	assert.NoError(t, Validate(&pair{Pair: "a,b"}))
+	assert.Equal(t, map[string]string{"pair": "regex"}, validationPaths(t, Validate(&pair{Pair: "ab"})))
+}
+
+func TestRegisterValidator_builtin(t *testing.T) {
+	assert.Panics(t, func() { RegisterValidator("min", nil) })
+	assert.Panics(t, func() { RegisterValidator("unique", nil) })
+}
+
+func TestValidateSet(t *testing.T) {
+	assert.NoError(t, validateSet[*TestValidUser](bson.D{{Key: "name", Value: "Bob"}, {Key: "tags.0", Value: "b"}}))
+
+	err := validateSet[*TestValidUser](bson.D{
+		{Key: "name", Value: ""},
+		{Key: "age", Value: int64(-1)},
+		{Key: "tags.1", Value: "z"},
+		{Key: "address", Value: TestValidAddress{}},
+		{Key: "addresses.0.country", Value: "FRA"},
+	})
+	assert.Equal(t, map[string]string{
+		"name":                "required",
+		"age":                 "min",
+		"tags.1":              "enum",
+		"address.city":        "required",
+		"addresses.0.country": "len",
+	}, validationPaths(t, err))
+
+	u := Model[*TestValidUser]()
+	_, err = NewUpdate[*TestValidUser]().Set(&u.Role, "root").render(context.Background())
+	assert.Equal(t, map[string]string{"role": "enum"}, validationPaths(t, err))
+}
+
+func TestRepo_InsertOne_validation(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestValidUser](db.Collection(testColl))
+	ctx := context.Background()
+
+	_, err := repo.InsertOne(ctx, &TestValidUser{Name: "A"})
+	assert.Equal(t, map[string]string{"name": "min", "email": "required"}, validationPaths(t, err))
+
+	err = repo.InsertMany(ctx, []*TestValidUser{{Name: "Alice", Email: "alice@example.com"}, {Name: "Bob"}})
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, 1, validationErr.Index)
+	count, err := repo.Count(ctx, bson.D{})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	doc, err := repo.InsertOne(ctx, &TestValidUser{Name: "Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	_, err = repo.UpdateByID(ctx, doc.ID, &TestValidUser{Name: "Alice", Age: 20})
+	assert.NoError(t, err)
+	_, err = repo.UpdateByID(ctx, doc.ID, &TestValidUser{Name: "Alice", Age: 200})
+	assert.Equal(t, map[string]string{"age": "max"}, validationPaths(t, err))
+	// The update would clear name, which is not omitempty.
+	_, err = repo.UpdateByID(ctx, doc.ID, &TestValidUser{Age: 20})
+	assert.Equal(t, map[string]string{"name": "required"}, validationPaths(t, err))
+}
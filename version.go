@@ -0,0 +1,113 @@
+package modm
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned when a versioned update matches no document,
+// because the document has been modified (or removed) since it was read.
+var ErrVersionConflict = errors.New("modm: version conflict")
+
+// VersionField is a mixin that enables optimistic concurrency control. Embed it next to DefaultField:
+//
+//	type User struct {
+//		modm.DefaultField `bson:",inline"`
+//		modm.VersionField `bson:",inline"`
+//		Name              string `bson:"name,omitempty" json:"name"`
+//	}
+//
+// When UpdateOne, UpdateByID or FindOneAndUpdate is called with a document, the current version of
+// the document is added to the filter and incremented by the update. If no document matches,
+// ErrVersionConflict is returned. To version raw update documents, use WithVersion. UpdateMany with
+// a document and *Update[T] increment the version without checking it.
+type VersionField struct {
+	Version int64 `bson:"version" json:"version"`
+}
+
+func (vf *VersionField) versionField() *VersionField {
+	return vf
+}
+
+// versioned is implemented by documents that embed VersionField.
+type versioned interface {
+	versionField() *VersionField
+}
+
+// WithVersion returns a context that makes UpdateOne, UpdateByID and FindOneAndUpdate with a raw
+// update document only match the given version, and increment it.
+func WithVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, ctxKeyVersion, version)
+}
+
+func versionOf(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(ctxKeyVersion).(int64)
+	return version, ok
+}
+
+// versionFilter returns filter restricted to documents with the given version.
+// Documents without a version field match version 0.
+func versionFilter(filter interface{}, version int64) interface{} {
+	cond := bson.M{"version": version}
+	if version == 0 {
+		cond = bson.M{"version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	if filter == nil {
+		return cond
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, cond}}}
+}
+
+// versionUpdate returns update with an increment of the version field.
+// The update must be a document of update operators; pipelines are not supported.
+func versionUpdate(update interface{}) (interface{}, error) {
+	raw, err := bson.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return nil, err
+	}
+	result := make(bson.D, 0, len(elems)+1)
+	inc := bson.D{{Key: "version", Value: int64(1)}}
+	for _, elem := range elems {
+		if elem.Key() == "$inc" {
+			var fields bson.D
+			if err := elem.Value().Unmarshal(&fields); err != nil {
+				return nil, err
+			}
+			inc = append(fields, inc...)
+			continue
+		}
+		result = append(result, bson.E{Key: elem.Key(), Value: elem.Value()})
+	}
+	return append(result, bson.E{Key: "$inc", Value: inc}), nil
+}
+
+// versioning returns the expected version of an update, and whether the update is versioned.
+func (r *Repo[T]) versioning(ctx context.Context, updateOrDoc interface{}) (int64, bool) {
+	if doc, ok := updateOrDoc.(T); ok {
+		if v, ok := interface{}(doc).(versioned); ok {
+			return v.versionField().Version, true
+		}
+		return 0, false
+	}
+	return versionOf(ctx)
+}
+
+// applyVersion restricts filter to the expected version and increments it in a raw update.
+// Documents and *Update[T] already increment the version (see documentSet and Update.render).
+func (r *Repo[T]) applyVersion(filter interface{}, updateOrDoc interface{}, update interface{}, version int64) (interface{}, interface{}, error) {
+	switch updateOrDoc.(type) {
+	case T, *Update[T]:
+	default:
+		var err error
+		if update, err = versionUpdate(update); err != nil {
+			return nil, nil, err
+		}
+	}
+	return versionFilter(filter, version), update, nil
+}
@@ -0,0 +1,115 @@
+package modm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TestVersionedUser struct {
+	DefaultField `bson:",inline"`
+	VersionField `bson:",inline"`
+	Name         string `bson:"name,omitempty" json:"name"`
+	Age          uint   `bson:"age,omitempty" json:"age"`
+}
+
+func TestVersionUpdate(t *testing.T) {
+	update, err := versionUpdate(bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: "go"}}},
+		{Key: "$inc", Value: bson.D{{Key: "age", Value: 1}}},
+	})
+	require.NoError(t, err)
+	raw, err := bson.Marshal(update)
+	require.NoError(t, err)
+	var got bson.M
+	require.NoError(t, bson.Unmarshal(raw, &got))
+	assert.Equal(t, bson.M{
+		"$set": bson.M{"name": "go"},
+		"$inc": bson.M{"age": int32(1), "version": int64(1)},
+	}, got)
+
+	_, err = versionUpdate(bson.A{bson.M{"$set": bson.M{"name": "go"}}})
+	assert.Error(t, err)
+}
+
+func TestVersionFilter(t *testing.T) {
+	filter := bson.M{"name": "go"}
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{filter, bson.M{"version": int64(2)}}}}, versionFilter(filter, 2))
+	assert.Equal(t, bson.M{"version": bson.M{"$in": bson.A{0, nil}}}, versionFilter(nil, 0))
+}
+
+func TestRepo_documentSetVersion(t *testing.T) {
+	update, err := NewRepo[*TestVersionedUser](nil).documentSet(&TestVersionedUser{Name: "go"})
+	require.NoError(t, err)
+	raw, err := bson.Marshal(update)
+	require.NoError(t, err)
+	var got bson.M
+	require.NoError(t, bson.Unmarshal(raw, &got))
+	assert.NotContains(t, got["$set"], "version")
+	assert.Equal(t, bson.M{"version": int64(1)}, got["$inc"])
+}
+
+func TestUpdate_renderVersion(t *testing.T) {
+	u := Model[*TestVersionedUser]()
+	update, err := NewUpdate[*TestVersionedUser]().Inc(&u.Age, 1).render(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "$inc", update[0].Key)
+	assert.Equal(t, bson.D{{Key: "age", Value: 1}, {Key: "version", Value: int64(1)}}, update[0].Value)
+
+	// The version is not incremented twice.
+	update, err = NewUpdate[*TestVersionedUser]().Inc(&u.Version, 2).render(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "version", Value: 2}}, update[0].Value)
+}
+
+func TestRepo_Version(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	repo := NewRepo[*TestVersionedUser](db.Collection(testColl))
+
+	ctx := context.TODO()
+	user, err := repo.InsertOne(ctx, &TestVersionedUser{Name: "go", Age: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), user.Version)
+
+	first, err := repo.Get(ctx, user.ID)
+	require.NoError(t, err)
+	second, err := repo.Get(ctx, user.ID)
+	require.NoError(t, err)
+
+	first.Age = 3
+	_, err = repo.UpdateByID(ctx, first.ID, first)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first.Version)
+
+	second.Age = 4
+	_, err = repo.UpdateByID(ctx, second.ID, second)
+	require.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = repo.UpdateOne(WithVersion(ctx, 0), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"age": 5}})
+	require.ErrorIs(t, err, ErrVersionConflict)
+	_, err = repo.UpdateOne(WithVersion(ctx, 1), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"age": 5}})
+	require.NoError(t, err)
+
+	updated, err := repo.FindOneAndUpdate(WithVersion(ctx, 2), bson.M{"_id": user.ID}, bson.M{"$inc": bson.M{"age": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+	assert.Equal(t, uint(6), updated.Age)
+
+	_, err = repo.FindOneAndUpdate(ctx, bson.M{"_id": user.ID}, second)
+	require.ErrorIs(t, err, ErrVersionConflict)
+
+	// UpdateMany with a document and typed updates increment the version too.
+	_, err = repo.UpdateMany(ctx, bson.M{"_id": user.ID}, &TestVersionedUser{Age: 7})
+	require.NoError(t, err)
+	u := Model[*TestVersionedUser]()
+	_, err = repo.UpdateOne(ctx, bson.M{"_id": user.ID}, NewUpdate[*TestVersionedUser]().Set(&u.Age, uint(8)))
+	require.NoError(t, err)
+	updated, err = repo.Get(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), updated.Version)
+	assert.Equal(t, uint(8), updated.Age)
+}